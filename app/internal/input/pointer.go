@@ -210,7 +210,7 @@ func (q *pointerQueue) Push(e pointer.Event, events *handlerEvents) {
 		pidx = len(q.pointers) - 1
 	}
 	p := &q.pointers[pidx]
-	if !p.pressed && (e.Type == pointer.Move || e.Type == pointer.Press) {
+	if !p.pressed && (e.Type == pointer.Move || e.Type == pointer.Press || e.Type == pointer.Enter) {
 		p.handlers, q.scratch = q.scratch[:0], p.handlers
 		q.opHit(&p.handlers, e.Position)
 		if e.Type == pointer.Press {
@@ -233,7 +233,9 @@ func (q *pointerQueue) Push(e pointer.Event, events *handlerEvents) {
 			q.dropHandler(k, events)
 		}
 	}
-	if e.Type == pointer.Release {
+	// A pointer that left the window no longer hovers over its
+	// handlers, unless it is still pressed.
+	if e.Type == pointer.Release || e.Type == pointer.Leave && !p.pressed {
 		q.pointers = append(q.pointers[:pidx], q.pointers[pidx+1:]...)
 	}
 	for _, k := range p.handlers {
@@ -445,6 +445,8 @@ func (w *window) ShowTextInput(show bool) {
 	})
 }
 
+func (w *window) SetTitle(title string) {}
+
 func (w *window) RegisterFragment(del string) {
 	runInJVM(func(env *C.JNIEnv) {
 		cdel := C.CString(del)
@@ -250,6 +250,8 @@ func (w *window) ShowTextInput(show bool) {
 	}
 }
 
+func (w *window) SetTitle(title string) {}
+
 func NewWindow(win Callbacks, opts *Options) error {
 	mainWindow.in <- windowAndOptions{win, opts}
 	return <-mainWindow.errs
@@ -355,6 +355,11 @@ func (w *window) ShowTextInput(show bool) {
 	}()
 }
 
+func (w *window) SetTitle(title string) {
+	doc := js.Global().Get("document")
+	doc.Set("title", title)
+}
+
 func (w *window) draw(sync bool) {
 	width, height, scale, cfg := w.config()
 	if cfg == (config{}) || width == 0 || height == 0 {
@@ -417,6 +422,8 @@ func translateKey(k string) (string, bool) {
 		n = key.NameDeleteBackward
 	case "Delete":
 		n = key.NameDeleteForward
+	case "Insert":
+		n = key.NameInsert
 	case "Home":
 		n = key.NameHome
 	case "End":
@@ -428,7 +435,7 @@ func translateKey(k string) (string, bool) {
 	case "Tab":
 		n = key.NameTab
 	case " ":
-		n = "Space"
+		n = key.NameSpace
 	case "F1", "F2", "F3", "F4", "F5", "F6", "F7", "F8", "F9", "F10", "F11", "F12":
 		n = k
 	default:
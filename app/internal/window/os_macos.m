@@ -62,6 +62,14 @@ CGFloat gio_getViewBackingScale(CFTypeRef viewRef) {
 	return [view.window backingScaleFactor];
 }
 
+void gio_setTitle(CFTypeRef viewRef, const char *title) {
+	NSView *view = (__bridge NSView *)viewRef;
+	NSString *str = [NSString stringWithUTF8String: title];
+	dispatch_async(dispatch_get_main_queue(), ^{
+		view.window.title = str;
+	});
+}
+
 void gio_main(CFTypeRef viewRef, const char *title, CGFloat width, CGFloat height) {
 	@autoreleasepool {
 		NSView *view = (NSView *)CFBridgingRelease(viewRef);
@@ -6,14 +6,42 @@ package window
 
 import (
 	"errors"
+	"sync"
 )
 
 var mainDone = make(chan struct{})
 
+// windows counts the open windows of drivers that support
+// more than one window.
+var windows struct {
+	mu    sync.Mutex
+	count int
+	done  bool
+}
+
 func Main() {
 	<-mainDone
 }
 
+// windowOpened records a new window.
+func windowOpened() {
+	windows.mu.Lock()
+	defer windows.mu.Unlock()
+	windows.count++
+}
+
+// windowClosed records the destruction of a window, and
+// ends Main when no windows are left.
+func windowClosed() {
+	windows.mu.Lock()
+	defer windows.mu.Unlock()
+	windows.count--
+	if windows.count == 0 && !windows.done {
+		windows.done = true
+		close(mainDone)
+	}
+}
+
 // instead of creating files with build tags for each combination of wayland +/- x11
 // let each driver initialize these variables with their own version of createWindow.
 var wlDriver, x11Driver func(Callbacks, *Options) error
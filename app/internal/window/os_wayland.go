@@ -661,11 +661,14 @@ func gio_onKeyboardKey(data unsafe.Pointer, keyboard *C.struct_wl_keyboard, seri
 	w := winMap[keyboard]
 	w.resetFling()
 	conn.repeat.Stop(t)
+	kc := mapXKBKeycode(uint32(keyCode))
 	if state != C.WL_KEYBOARD_KEY_STATE_PRESSED {
+		for _, e := range conn.xkb.DispatchKey(kc, key.Release) {
+			w.w.Event(e)
+		}
 		return
 	}
-	kc := mapXKBKeycode(uint32(keyCode))
-	for _, e := range conn.xkb.DispatchKey(kc) {
+	for _, e := range conn.xkb.DispatchKey(kc, key.Press) {
 		w.w.Event(e)
 	}
 	if conn.xkb.IsRepeatKey(kc) {
@@ -743,7 +746,11 @@ func (r *repeatState) Repeat() {
 		if r.last+delay > now {
 			break
 		}
-		for _, e := range conn.xkb.DispatchKey(r.key) {
+		for _, e := range conn.xkb.DispatchKey(r.key, key.Press) {
+			if ke, ok := e.(key.Event); ok {
+				ke.Repeat = true
+				e = ke
+			}
 			r.win.Event(e)
 		}
 		r.last += delay
@@ -1066,6 +1073,13 @@ func (w *window) surface() (*C.struct_wl_surface, int, int) {
 
 func (w *window) ShowTextInput(show bool) {}
 
+func (w *window) SetTitle(title string) {
+	ctitle := C.CString(title)
+	defer C.free(unsafe.Pointer(ctitle))
+	C.xdg_toplevel_set_title(w.topLvl, ctitle)
+	C.wl_display_flush(w.disp)
+}
+
 // detectUIScale reports the system UI scale, or 1.0 if it fails.
 func detectUIScale() float32 {
 	// TODO: What about other window environments?
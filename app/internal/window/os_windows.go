@@ -35,9 +35,15 @@ type window struct {
 
 	mu        sync.Mutex
 	animating bool
+	// title is the latest title of SetTitle.
+	title string
 }
 
-const _WM_REDRAW = windows.WM_USER + 0
+const (
+	_WM_REDRAW = windows.WM_USER + 0
+	// _WM_SETTITLE asks the window thread to set the title.
+	_WM_SETTITLE = windows.WM_USER + 1
+)
 
 var onceMu sync.Mutex
 var mainDone = make(chan struct{})
@@ -200,6 +206,12 @@ func windowProc(hwnd syscall.Handle, msg uint32, wParam, lParam uintptr) uintptr
 		case windows.SIZE_MAXIMIZED, windows.SIZE_RESTORED:
 			w.setStage(system.StageRunning)
 		}
+	case _WM_SETTITLE:
+		w.mu.Lock()
+		title := w.title
+		w.mu.Unlock()
+		windows.SetWindowText(hwnd, title)
+		return 0
 	}
 	return windows.DefWindowProc(hwnd, msg, wParam, lParam)
 }
@@ -345,6 +357,18 @@ func (w *window) destroy() {
 
 func (w *window) ShowTextInput(show bool) {}
 
+// SetTitle sets the title from the window thread. SetWindowText sends
+// WM_SETTEXT and waits for the window thread, which may itself be
+// waiting for the caller to receive an event.
+func (w *window) SetTitle(title string) {
+	w.mu.Lock()
+	w.title = title
+	w.mu.Unlock()
+	if err := windows.PostMessage(w.hwnd, _WM_SETTITLE, 0, 0); err != nil {
+		panic(err)
+	}
+}
+
 func (w *window) HDC() syscall.Handle {
 	return w.hdc
 }
@@ -379,38 +403,40 @@ func convertKeyCode(code uintptr) (string, bool) {
 		r = key.NameDeleteBackward
 	case windows.VK_DELETE:
 		r = key.NameDeleteForward
+	case windows.VK_INSERT:
+		r = key.NameInsert
 	case windows.VK_PRIOR:
 		r = key.NamePageUp
 	case windows.VK_NEXT:
 		r = key.NamePageDown
 	case windows.VK_F1:
-		r = "F1"
+		r = key.NameF1
 	case windows.VK_F2:
-		r = "F2"
+		r = key.NameF2
 	case windows.VK_F3:
-		r = "F3"
+		r = key.NameF3
 	case windows.VK_F4:
-		r = "F4"
+		r = key.NameF4
 	case windows.VK_F5:
-		r = "F5"
+		r = key.NameF5
 	case windows.VK_F6:
-		r = "F6"
+		r = key.NameF6
 	case windows.VK_F7:
-		r = "F7"
+		r = key.NameF7
 	case windows.VK_F8:
-		r = "F8"
+		r = key.NameF8
 	case windows.VK_F9:
-		r = "F9"
+		r = key.NameF9
 	case windows.VK_F10:
-		r = "F10"
+		r = key.NameF10
 	case windows.VK_F11:
-		r = "F11"
+		r = key.NameF11
 	case windows.VK_F12:
-		r = "F12"
+		r = key.NameF12
 	case windows.VK_TAB:
 		r = key.NameTab
 	case windows.VK_SPACE:
-		r = "Space"
+		r = key.NameSpace
 	case windows.VK_OEM_1:
 		r = ";"
 	case windows.VK_OEM_PLUS:
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+// +build linux,!android,!nox11 freebsd
+
+#include <stddef.h>
+#include <X11/Xlib.h>
+#include "os_x11.h"
+#include "_cgo_export.h"
+
+// XSetIOErrorExitHandler is new in libX11 1.7. It is declared weak
+// so that older versions, which always exit the process after an
+// I/O error, still link.
+extern void XSetIOErrorExitHandler(Display *dpy, void (*handler)(Display *, void *), void *data) __attribute__((weak));
+
+static int gio_x11_error_code;
+
+static int gio_x11_trap_handler(Display *dpy, XErrorEvent *e) {
+	gio_x11_error_code = e->error_code;
+	return 0;
+}
+
+// gio_x11_trap_errors records errors instead of reporting them
+// until gio_x11_untrap_errors.
+XErrorHandler gio_x11_trap_errors(void) {
+	gio_x11_error_code = 0;
+	return XSetErrorHandler(gio_x11_trap_handler);
+}
+
+// gio_x11_untrap_errors restores the previous error handler
+// and returns the code of the last trapped error, if any.
+int gio_x11_untrap_errors(Display *dpy, XErrorHandler old) {
+	XSync(dpy, False);
+	XSetErrorHandler(old);
+	return gio_x11_error_code;
+}
+
+static int gio_x11_error_handler(Display *dpy, XErrorEvent *e) {
+	gio_x11_onError(dpy, e);
+	return 0;
+}
+
+static int gio_x11_io_error_handler(Display *dpy) {
+	gio_x11_onIOError(dpy);
+	return 0;
+}
+
+static void gio_x11_io_exit_handler(Display *dpy, void *data) {
+	// Return to the caller instead of exiting. The connection
+	// is unusable from now on.
+}
+
+// gio_x11_set_error_handlers replaces the default error handlers
+// of Xlib, which exit the process.
+void gio_x11_set_error_handlers(void) {
+	XSetErrorHandler(gio_x11_error_handler);
+	XSetIOErrorHandler(gio_x11_io_error_handler);
+}
+
+// gio_x11_set_io_exit_handler keeps the process alive after an I/O
+// error of the connection, if supported by Xlib.
+void gio_x11_set_io_exit_handler(Display *dpy) {
+	if (XSetIOErrorExitHandler != NULL) {
+		XSetIOErrorExitHandler(dpy, gio_x11_io_exit_handler, NULL);
+	}
+}
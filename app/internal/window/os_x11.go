@@ -5,7 +5,7 @@
 package window
 
 /*
-#cgo LDFLAGS: -lX11 -lxkbcommon -lxkbcommon-x11 -lX11-xcb
+#cgo LDFLAGS: -lX11 -lxkbcommon -lxkbcommon-x11 -lX11-xcb -lXrandr -lXi -lXext -lXcursor
 #include <stdlib.h>
 #include <locale.h>
 #include <X11/Xlib.h>
@@ -13,29 +13,55 @@ package window
 #include <X11/Xutil.h>
 #include <X11/Xresource.h>
 #include <X11/XKBlib.h>
+#include <X11/cursorfont.h>
+#include <X11/Xcursor/Xcursor.h>
 #include <X11/Xlib-xcb.h>
+#include <X11/extensions/Xrandr.h>
+#include <X11/extensions/XInput2.h>
+#include <X11/extensions/sync.h>
 #include <xkbcommon/xkbcommon-x11.h>
-
+#include "os_x11.h"
 */
 import "C"
 import (
+	gocontext "context"
 	"errors"
 	"fmt"
 	"image"
+	"image/color"
+	"log"
+	"math"
+	"math/bits"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 	"unsafe"
 
 	"gioui.org/f32"
+	"gioui.org/io/event"
 	"gioui.org/io/key"
 	"gioui.org/io/pointer"
 	"gioui.org/io/system"
+	"gioui.org/unit"
 
 	"gioui.org/app/internal/xkb"
 	syscall "golang.org/x/sys/unix"
 )
 
+// x11Window is the X11 driver of a window. Its event loop runs in
+// a goroutine of its own, while the exported methods are called from
+// other goroutines. Xlib serializes the requests of both, because
+// XInitThreads is called before the first display is opened, and the
+// methods flush their requests so that they take effect without
+// waiting for the loop. Methods that wait for replies, such as
+// through XSync, must call wakeupQueued afterwards: Xlib may read
+// events while it waits, and the loop only learns about events
+// from the connection.
 type x11Window struct {
 	w            Callbacks
 	x            *C.Display
@@ -44,21 +70,364 @@ type x11Window struct {
 	xw           C.Window
 
 	evDelWindow C.Atom
-	stage       system.Stage
-	cfg         config
-	width       int
-	height      int
-	notify      struct {
+	atoms       struct {
+		// "UTF8_STRING".
+		utf8string C.Atom
+		// "_NET_WM_NAME".
+		wmName C.Atom
+		// "CLIPBOARD".
+		clipboard C.Atom
+		// "CLIPBOARD_CONTENT", the clipboard destination property.
+		clipboardContent C.Atom
+		// "PRIMARY_CONTENT", the PRIMARY selection destination property.
+		primaryContent C.Atom
+		// "TARGETS"
+		targets C.Atom
+		// "text/plain"
+		textPlain C.Atom
+		// "INCR"
+		incr C.Atom
+		// "_NET_WM_ICON"
+		wmIcon C.Atom
+		// "_NET_WM_WINDOW_OPACITY"
+		wmOpacity C.Atom
+		// "_NET_WM_STATE"
+		wmState C.Atom
+		// "_NET_WM_STATE_FULLSCREEN"
+		wmStateFullscreen C.Atom
+		// "_NET_WM_STATE_MAXIMIZED_HORZ"
+		wmStateMaxHorz C.Atom
+		// "_NET_WM_STATE_MAXIMIZED_VERT"
+		wmStateMaxVert C.Atom
+		// "_NET_WM_STATE_ABOVE"
+		wmStateAbove C.Atom
+		// "_NET_WM_STATE_DEMANDS_ATTENTION"
+		wmStateDemandsAttention C.Atom
+		// "_MOTIF_WM_HINTS"
+		motifHints C.Atom
+		// "_NET_FRAME_EXTENTS"
+		frameExtents C.Atom
+		// "_NET_WM_MOVERESIZE"
+		wmMoveResize C.Atom
+		// "WM_PROTOCOLS", the type of window manager
+		// protocol messages.
+		wmProtocols C.Atom
+		// "_NET_WM_PING", the protocol for detecting
+		// unresponsive programs.
+		wmPing C.Atom
+		// "WM_STATE", the ICCCM window state.
+		icccmState C.Atom
+		// "RESOURCE_MANAGER", the resource database of the
+		// root window.
+		resourceManager C.Atom
+		// "_NET_WM_CM_Sn", the selection of the compositing
+		// manager of the default screen n.
+		cmSelection C.Atom
+		// "MANAGER", the announcement of new selection owners.
+		manager C.Atom
+		// "_XEMBED"
+		xembed C.Atom
+		// "_XEMBED_INFO"
+		xembedInfo C.Atom
+		// XDND atoms.
+		xdnd struct {
+			aware, enter, position, status, leave, drop, finished C.Atom
+			selection, typeList, actionCopy                       C.Atom
+			// "text/uri-list"
+			uriList C.Atom
+			// "XDND_CONTENT", the destination property of drops.
+			content C.Atom
+		}
+	}
+	stage  system.Stage
+	cfg    config
+	width  int
+	height int
+	notify struct {
 		read, write int
 	}
 	dead bool
+	// connErr is set when the connection to the X server is lost.
+	connErr error
+	// ioErr is set by the I/O error handler of Xlib. It has its
+	// own lock, because the handler runs inside Xlib calls that
+	// may be made with mu held.
+	ioErr struct {
+		mu  sync.Mutex
+		err error
+	}
+	// dnd is the state of the current XDND drag.
+	dnd struct {
+		// source is the window of the drag source.
+		source C.Window
+		// accept is set if the source offers text/uri-list.
+		accept bool
+	}
+	// embedder is the XEmbed embedder of the window, if any.
+	embedder C.Window
+	// visibility tracks the reasons for pausing the window.
+	visibility struct {
+		iconic   bool
+		unmapped bool
+		obscured bool
+		// mapped is set by MapNotify. Unlike unmapped, it is
+		// false until the window is first mapped.
+		mapped bool
+		// reported is the last VisibilityEvent.
+		reported system.VisibilityEvent
+	}
 
+	// mu protects the fields below and writes to cfg.
 	mu        sync.Mutex
 	animating bool
+	// closing is set by Close.
+	closing bool
+	// invalidated is set by Invalidate until the next frame.
+	invalidated bool
+	// wakeupAt is the time of the frame requested by
+	// ScheduleWakeup, or zero.
+	wakeupAt time.Time
+	// compositor is the owner of the compositing manager
+	// selection, or None.
+	compositor C.Window
+	// stop is closed when the window is destroyed.
+	stop chan struct{}
+	// clock converts the time of X events.
+	clock x11Clock
+	// coalesceEdits enables the coalescing of key.EditEvents
+	// by keyEvent.
+	coalesceEdits bool
+	// edit is the coalesced text not yet delivered.
+	edit string
+	// frameInterval is the minimum time between frames not
+	// required by the system, or zero.
+	frameInterval time.Duration
+	// sizeHints are the size constraints for the window
+	// manager.
+	sizeHints struct {
+		minWidth, minHeight unit.Value
+		maxWidth, maxHeight unit.Value
+		// pos is the position requested by the user, if
+		// hasPos is set.
+		pos    image.Point
+		hasPos bool
+		// fixed disables resizing at the requested width and
+		// height.
+		fixed         bool
+		width, height unit.Value
+	}
+	// clipboard is the content served while the window
+	// owns the CLIPBOARD selection.
+	clipboard x11Selection
+	// primary is the content served while the window
+	// owns the PRIMARY selection.
+	primary x11Selection
+	// selectionReads tracks the pending selection reads by
+	// the property of their content.
+	selectionReads map[C.Atom]*x11SelectionRead
+	// cursors caches the cursors created by SetCursor.
+	cursors map[pointer.CursorName]C.Cursor
+	// damage is the exposed region for the next frame.
+	damage image.Rectangle
+	// fullscreen is the last requested fullscreen state.
+	fullscreen bool
+	// maximized is the maximized state set by the window
+	// manager.
+	maximized bool
+	// above is the always on top state set by the window
+	// manager.
+	above bool
+	// focused is set while the window has keyboard focus.
+	focused bool
+	// urgent is set while the window has the urgency hint.
+	urgent bool
+	// clientMessage is the handler of unknown client messages.
+	clientMessage func(msg ClientMessage)
+	// extents is the size of the window manager decorations.
+	extents FrameExtentsEvent
+	// pos is the position of the window in root coordinates.
+	pos image.Point
+	// bounds is the last reported window rectangle, including
+	// the decorations.
+	bounds image.Rectangle
+	// pointerGrab is set while the window grabs the pointer.
+	pointerGrab bool
+	// keyboardGrab is set while the window grabs the keyboard.
+	keyboardGrab bool
+	// hotkeys maps the grabbed keys to their hotkeys.
+	hotkeys map[x11Hotkey]system.HotkeyEvent
 
 	pointerBtns pointer.Buttons
+	clicks      x11ClickCounter
+	// keysDown tracks the pressed keys by keycode, for detecting
+	// auto-repeated presses.
+	keysDown [256]bool
+	// detectableRepeat is set if the server omits the KeyRelease
+	// events for auto-repeated keys.
+	detectableRepeat bool
+
+	// resources is the resource database string of the
+	// server, for the UI scale.
+	resources string
+	// fontScale is the font scale of the options, or zero.
+	fontScale float32
+	// resourceTimer delays the reload of changed resources.
+	// It and resourcesChanged are protected by mu.
+	resourceTimer    *time.Timer
+	resourcesChanged bool
+	// randr is set if the RandR extension is available, and
+	// randrEventBase is the type of its first event.
+	randr          bool
+	randrEventBase C.int
+	// monitors caches the active CRTCs while monitorsValid is
+	// set, until RandR reports a change.
+	monitors      []x11Monitor
+	monitorsValid bool
+	// monitor is the monitor the window was last seen on.
+	monitor x11Monitor
+
+	// xi2 is the XInput 2 state for smooth scrolling and
+	// touch input.
+	xi2 struct {
+		// opcode is the major opcode of the extension, or 0 if
+		// XInput 2.1 is unavailable.
+		opcode C.int
+		// valuators maps slave device ids to their scroll
+		// valuators.
+		valuators map[C.int][]x11ScrollValuator
+		// touches maps active touches to pointer IDs. It is nil
+		// if touch events, available from XInput 2.2, are not
+		// selected.
+		touches x11Touches
+		// scroll is the scroll distance of the motion events
+		// superseded by a later motion event.
+		scroll f32.Point
+		// emulatedWheel reports whether the last raw wheel button
+		// event was emulated from scroll valuators, whose motion
+		// events already report the scrolling.
+		emulatedWheel bool
+	}
+	// sync is the state of the _NET_WM_SYNC_REQUEST protocol.
+	sync struct {
+		// request is the WM_PROTOCOLS atom of the protocol.
+		request C.Atom
+		// counter is the XSync counter updated after frames,
+		// or 0 if the protocol is not supported.
+		counter C.XSyncCounter
+		// value is the counter value requested by the window
+		// manager, set when pending.
+		value   C.XSyncValue
+		pending bool
+	}
+}
+
+// x11ScrollValuator is a device axis reporting smooth scrolling.
+type x11ScrollValuator struct {
+	number     int
+	horizontal bool
+	// increment is the valuator distance of one scroll step.
+	increment float64
+	// value is the last known valuator value, if valid.
+	value float64
+	valid bool
+}
+
+// x11Monitor describes the RandR CRTC displaying
+// a point of the root window.
+type x11Monitor struct {
+	crtc C.RRCrtc
+	// bounds of the CRTC in root window coordinates.
+	bounds image.Rectangle
+	// dpi is the density computed from the physical size of the
+	// output, or 0 if the size is unknown.
+	dpi float32
+	// refreshRate of the CRTC mode in Hz.
+	refreshRate float32
+}
+
+// x11Mode is the timing of a display mode.
+type x11Mode struct {
+	// dotClock is the pixel clock in Hz.
+	dotClock       uint64
+	hTotal, vTotal uint32
+	interlace      bool
+	doubleScan     bool
+}
+
+// x11DefaultRefreshRate is assumed when RandR is unavailable.
+const x11DefaultRefreshRate = 60
+
+// refreshRate returns the refresh rate of the mode in Hz.
+func (m x11Mode) refreshRate() float32 {
+	lines := float64(m.vTotal)
+	if m.doubleScan {
+		lines *= 2
+	}
+	if m.interlace {
+		lines /= 2
+	}
+	if m.hTotal == 0 || lines == 0 {
+		return 0
+	}
+	return float32(float64(m.dotClock) / (float64(m.hTotal) * lines))
+}
+
+// x11ClickCounter counts successive button presses.
+type x11ClickCounter struct {
+	// interval is the maximum time between the presses of
+	// a multiple click.
+	interval time.Duration
+	count    int
+	btn      pointer.Buttons
+	pos      image.Point
+	time     time.Duration
+}
+
+const (
+	// x11ClickInterval is the default click interval.
+	x11ClickInterval = 400 * time.Millisecond
+	// x11ClickRadius is the distance in pixels the pointer may
+	// move between the presses of a multiple click.
+	x11ClickRadius = 4
+)
+
+// press records a press of btn and returns the click count.
+func (c *x11ClickCounter) press(btn pointer.Buttons, pos image.Point, t time.Duration) int {
+	if c.count > 0 && btn == c.btn && t-c.time <= c.interval && c.near(pos) {
+		c.count++
+	} else {
+		c.count = 1
+	}
+	c.btn, c.pos, c.time = btn, pos, t
+	return c.count
 }
 
+// move resets the count if the pointer moved too far from
+// the last press.
+func (c *x11ClickCounter) move(pos image.Point) {
+	if !c.near(pos) {
+		c.count = 0
+	}
+}
+
+func (c *x11ClickCounter) near(pos image.Point) bool {
+	d := pos.Sub(c.pos)
+	return d.X*d.X+d.Y*d.Y <= x11ClickRadius*x11ClickRadius
+}
+
+// ICCCM WM_STATE values.
+const (
+	x11NormalState = C.NormalState
+	x11IconicState = C.IconicState
+)
+
+// x11DefaultScrollScale is the default scroll distance in
+// pixels of one wheel step.
+const x11DefaultScrollScale = 10
+
+// default fixed DPI value used in most desktop UI toolkits
+const x11DefaultDPI = 96
+
 func (w *x11Window) SetAnimating(anim bool) {
 	w.mu.Lock()
 	w.animating = anim
@@ -70,8 +439,1381 @@ func (w *x11Window) SetAnimating(anim bool) {
 
 func (w *x11Window) ShowTextInput(show bool) {}
 
+// Invalidate requests a single FrameEvent.
+func (w *x11Window) Invalidate() {
+	w.mu.Lock()
+	w.invalidated = true
+	w.mu.Unlock()
+	w.wakeup()
+}
+
+// Composited reports whether a compositing manager owns the
+// _NET_WM_CM_Sn selection of the default screen.
+func (w *x11Window) Composited() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.compositor != C.None
+}
+
+// setCompositor records the owner window of the compositing manager
+// selection, zero for none, and reports whether compositing started
+// or stopped.
+func (w *x11Window) setCompositor(owner uintptr) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	changed := (owner != C.None) != (w.compositor != C.None)
+	w.compositor = C.Window(owner)
+	return changed
+}
+
+// updateCompositor checks the owner of the compositing manager
+// selection and watches it for destruction, because owners don't
+// announce that they stop. It returns the event for a change, or
+// nil.
+func (w *x11Window) updateCompositor() event.Event {
+	w.mu.Lock()
+	old := w.compositor
+	w.mu.Unlock()
+	owner := C.XGetSelectionOwner(w.x, w.atoms.cmSelection)
+	if owner != old {
+		x11ErrorMu.Lock()
+		errs := C.gio_x11_trap_errors()
+		if old != C.None {
+			C.XSelectInput(w.x, old, C.NoEventMask)
+		}
+		if owner != C.None {
+			C.XSelectInput(w.x, owner, C.StructureNotifyMask)
+		}
+		code := C.gio_x11_untrap_errors(w.x, errs)
+		x11ErrorMu.Unlock()
+		if code != 0 && owner != C.None && C.XGetSelectionOwner(w.x, w.atoms.cmSelection) != owner {
+			// The owner went away before it was watched.
+			owner = C.None
+		}
+	}
+	if !w.setCompositor(uintptr(owner)) {
+		return nil
+	}
+	return system.CompositorEvent{Composited: owner != C.None}
+}
+
+// compositorEvent handles the events of the root window and the
+// compositing manager, and reports whether xev was one of them.
+func (w *x11Window) compositorEvent(xev *C.XEvent) bool {
+	xany := (*C.XAnyEvent)(unsafe.Pointer(xev))
+	if xany.window == w.xw {
+		return false
+	}
+	switch xany._type {
+	case C.ClientMessage:
+		if xany.window != C.XDefaultRootWindow(w.x) {
+			return false
+		}
+		cevt := (*C.XClientMessageEvent)(unsafe.Pointer(xev))
+		// Client messages of the root window are selected for
+		// the MANAGER announcements of new owners.
+		data := (*[5]C.long)(unsafe.Pointer(&cevt.data))
+		if cevt.message_type == w.atoms.manager && C.Atom(data[1]) == w.atoms.cmSelection {
+			w.notifyCompositor()
+		}
+		return true
+	case C.DestroyNotify:
+		w.mu.Lock()
+		owner := w.compositor
+		w.mu.Unlock()
+		if xany.window == owner {
+			w.notifyCompositor()
+		}
+		return true
+	case C.ConfigureNotify, C.MapNotify, C.UnmapNotify, C.ReparentNotify,
+		C.GravityNotify, C.CirculateNotify:
+		// The structure of other windows is only watched for
+		// compositing managers, including former ones.
+		return true
+	}
+	return false
+}
+
+// notifyCompositor checks the compositing manager and sends
+// the event of a change.
+func (w *x11Window) notifyCompositor() {
+	if e := w.updateCompositor(); e != nil {
+		w.w.Event(e)
+	}
+}
+
+// ScheduleWakeup draws a frame at the time at, without the
+// cost of animating until then.
+func (w *x11Window) ScheduleWakeup(at time.Time) {
+	w.mu.Lock()
+	if !w.wakeupAt.IsZero() && !at.Before(w.wakeupAt) {
+		w.mu.Unlock()
+		return
+	}
+	w.wakeupAt = at
+	w.mu.Unlock()
+	// Recompute the poll timeout.
+	w.wakeup()
+}
+
+// forwardWakeups invalidates the window for every value received
+// from ch, until ch is closed or stop is closed. Like the wakeups of
+// Invalidate, the wakeups before a frame result in a single frame.
+func (w *x11Window) forwardWakeups(ch <-chan struct{}, stop <-chan struct{}) {
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-stop:
+			return
+		}
+		w.mu.Lock()
+		// The notify pipe is closed after stop.
+		select {
+		case <-stop:
+			w.mu.Unlock()
+			return
+		default:
+		}
+		w.invalidated = true
+		w.wakeup()
+		w.mu.Unlock()
+	}
+}
+
+// Close destroys the window. It is typically called after
+// cancelling a system.CommandClose event.
+func (w *x11Window) Close() {
+	w.mu.Lock()
+	w.closing = true
+	w.mu.Unlock()
+	w.wakeup()
+}
+
+// SetTitle updates the window title. Like the other methods, it is
+// safe to call from any goroutine.
+func (w *x11Window) SetTitle(title string) {
+	w.setTitle(title)
+	C.XFlush(w.x)
+}
+
+// SetSize requests a new size of the window. The window size is
+// updated when the resulting ConfigureNotify event arrives, and
+// redrawn at the following Expose event.
+func (w *x11Window) SetSize(width, height unit.Value) {
+	w.mu.Lock()
+	cfg := w.cfg
+	fixed := w.sizeHints.fixed
+	w.sizeHints.width, w.sizeHints.height = width, height
+	w.mu.Unlock()
+	if fixed {
+		w.updateSizeHints()
+	}
+	C.XResizeWindow(w.x, w.xw, C.uint(cfg.Px(width)), C.uint(cfg.Px(height)))
+	C.XFlush(w.x)
+}
+
+// SetFullscreen asks the window manager to add or remove the
+// fullscreen state of the window, as described by EWMH.
+func (w *x11Window) SetFullscreen(fullscreen bool) {
+	w.mu.Lock()
+	if w.fullscreen == fullscreen {
+		w.mu.Unlock()
+		return
+	}
+	w.fullscreen = fullscreen
+	w.mu.Unlock()
+	w.sendWMState(fullscreen, w.atoms.wmStateFullscreen, 0)
+	C.XFlush(w.x)
+}
+
+// Focused reports whether the window has keyboard focus.
+func (w *x11Window) Focused() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.focused
+}
+
+// SetMaximized asks the window manager to maximize or restore the
+// window. The resulting resize arrives as a ConfigureNotify event,
+// and the state change as a PropertyNotify of _NET_WM_STATE.
+func (w *x11Window) SetMaximized(maximized bool) {
+	w.sendWMState(maximized, w.atoms.wmStateMaxHorz, w.atoms.wmStateMaxVert)
+	C.XFlush(w.x)
+}
+
+// GrabPointer actively grabs the pointer, so pointer events outside
+// the window are reported to it.
+func (w *x11Window) GrabPointer() {
+	const mask = C.ButtonPressMask | C.ButtonReleaseMask | C.PointerMotionMask
+	status := C.XGrabPointer(w.x, w.xw, C.False, mask, C.GrabModeAsync, C.GrabModeAsync,
+		C.None, C.None, C.CurrentTime)
+	w.wakeupQueued()
+	if status != C.GrabSuccess {
+		log.Println("x11: pointer grab failed")
+		return
+	}
+	w.mu.Lock()
+	w.pointerGrab = true
+	w.mu.Unlock()
+	C.XFlush(w.x)
+}
+
+// ReleasePointer releases a grab from GrabPointer.
+func (w *x11Window) ReleasePointer() {
+	w.mu.Lock()
+	grabbed := w.pointerGrab
+	w.pointerGrab = false
+	w.mu.Unlock()
+	if grabbed {
+		C.XUngrabPointer(w.x, C.CurrentTime)
+		C.XFlush(w.x)
+	}
+}
+
+// x11ReleaseGrab reports whether a pointer grab is released
+// after a button release that leaves btns pressed. Grabs
+// end with the drag, even if the program forgets to
+// release them.
+func x11ReleaseGrab(grabbed bool, btns pointer.Buttons) bool {
+	return grabbed && btns == 0
+}
+
+// GrabKeyboard actively grabs the keyboard.
+func (w *x11Window) GrabKeyboard() {
+	status := C.XGrabKeyboard(w.x, w.xw, C.False, C.GrabModeAsync, C.GrabModeAsync, C.CurrentTime)
+	w.wakeupQueued()
+	if status != C.GrabSuccess {
+		log.Println("x11: keyboard grab failed")
+		return
+	}
+	w.mu.Lock()
+	w.keyboardGrab = true
+	w.mu.Unlock()
+	C.XFlush(w.x)
+}
+
+// ReleaseKeyboard releases a grab from GrabKeyboard.
+func (w *x11Window) ReleaseKeyboard() {
+	w.mu.Lock()
+	grabbed := w.keyboardGrab
+	w.keyboardGrab = false
+	w.mu.Unlock()
+	if grabbed {
+		C.XUngrabKeyboard(w.x, C.CurrentTime)
+		C.XFlush(w.x)
+	}
+}
+
+// x11Hotkey is a key grabbed on the root window.
+type x11Hotkey struct {
+	keycode C.uint
+	// state is the modifier mask without the lock modifiers.
+	state C.uint
+}
+
+// x11LockMasks are the modifiers that don't affect hotkeys: Caps
+// Lock and Num Lock, which is Mod2 on practically every system.
+const x11LockMasks = C.LockMask | C.Mod2Mask
+
+// x11ModifierMask converts modifiers to an X11 modifier mask.
+func x11ModifierMask(mods key.Modifiers) uint {
+	var mask uint
+	if mods.Contain(key.ModShift) {
+		mask |= C.ShiftMask
+	}
+	if mods.Contain(key.ModCtrl) {
+		mask |= C.ControlMask
+	}
+	if mods.Contain(key.ModAlt) {
+		mask |= C.Mod1Mask
+	}
+	if mods.Contain(key.ModSuper) {
+		mask |= C.Mod4Mask
+	}
+	return mask
+}
+
+// x11StateModifiers converts the modifier mask of an event
+// state to modifiers. It is the inverse of x11ModifierMask.
+func x11StateModifiers(state uint) key.Modifiers {
+	var mods key.Modifiers
+	if state&C.ShiftMask != 0 {
+		mods |= key.ModShift
+	}
+	if state&C.ControlMask != 0 {
+		mods |= key.ModCtrl
+	}
+	if state&C.Mod1Mask != 0 {
+		mods |= key.ModAlt
+	}
+	if state&C.Mod4Mask != 0 {
+		mods |= key.ModSuper
+	}
+	return mods
+}
+
+// hotkey returns the grab of the key with the keysym name sym.
+func (w *x11Window) hotkey(sym string, mods key.Modifiers) (x11Hotkey, bool) {
+	csym := C.CString(sym)
+	defer C.free(unsafe.Pointer(csym))
+	keysym := C.XStringToKeysym(csym)
+	if keysym == C.NoSymbol {
+		return x11Hotkey{}, false
+	}
+	keycode := C.XKeysymToKeycode(w.x, keysym)
+	if keycode == 0 {
+		return x11Hotkey{}, false
+	}
+	return x11Hotkey{keycode: C.uint(keycode), state: C.uint(x11ModifierMask(mods))}, true
+}
+
+// RegisterHotkey grabs a key on the root window. The key is grabbed
+// with every combination of the lock modifiers, so the hotkey works
+// regardless of Caps Lock and Num Lock.
+func (w *x11Window) RegisterHotkey(sym string, mods key.Modifiers) {
+	hk, ok := w.hotkey(sym, mods)
+	if !ok {
+		log.Printf("x11: no key for hotkey %q", sym)
+		return
+	}
+	root := C.XDefaultRootWindow(w.x)
+	x11ErrorMu.Lock()
+	old := C.gio_x11_trap_errors()
+	for _, lock := range []C.uint{0, C.LockMask, C.Mod2Mask, x11LockMasks} {
+		C.XGrabKey(w.x, C.int(hk.keycode), hk.state|lock, root, C.False, C.GrabModeAsync, C.GrabModeAsync)
+	}
+	code := C.gio_x11_untrap_errors(w.x, old)
+	x11ErrorMu.Unlock()
+	w.wakeupQueued()
+	if code != 0 {
+		// Another client grabbed the key first.
+		w.ungrabKey(hk)
+		log.Printf("x11: hotkey %q is not available", sym)
+		return
+	}
+	w.mu.Lock()
+	if w.hotkeys == nil {
+		w.hotkeys = make(map[x11Hotkey]system.HotkeyEvent)
+	}
+	w.hotkeys[hk] = system.HotkeyEvent{Sym: sym, Modifiers: mods}
+	w.mu.Unlock()
+}
+
+// UnregisterHotkey releases the grab of a hotkey.
+func (w *x11Window) UnregisterHotkey(sym string, mods key.Modifiers) {
+	hk, ok := w.hotkey(sym, mods)
+	if !ok {
+		return
+	}
+	w.mu.Lock()
+	_, exists := w.hotkeys[hk]
+	delete(w.hotkeys, hk)
+	w.mu.Unlock()
+	if exists {
+		w.ungrabKey(hk)
+		C.XFlush(w.x)
+	}
+}
+
+func (w *x11Window) ungrabKey(hk x11Hotkey) {
+	root := C.XDefaultRootWindow(w.x)
+	for _, lock := range []C.uint{0, C.LockMask, C.Mod2Mask, x11LockMasks} {
+		C.XUngrabKey(w.x, C.int(hk.keycode), hk.state|lock, root)
+	}
+}
+
+// SetAlwaysOnTop asks the window manager to keep the window above
+// other windows. Like SetMaximized, it only toggles its own
+// _NET_WM_STATE atom and leaves the other states alone.
+func (w *x11Window) SetAlwaysOnTop(on bool) {
+	w.sendWMState(on, w.atoms.wmStateAbove, 0)
+	C.XFlush(w.x)
+}
+
+// SetType sets the _NET_WM_WINDOW_TYPE property of the window.
+func (w *x11Window) SetType(typ string) {
+	w.setType(typ)
+	C.XFlush(w.x)
+}
+
+func (w *x11Window) setType(typ string) {
+	if typ == "" {
+		typ = "NORMAL"
+	}
+	// Xlib expects format 32 properties as arrays of longs.
+	a := C.ulong(w.atom("_NET_WM_WINDOW_TYPE_"+typ, false))
+	C.XChangeProperty(w.x, w.xw, w.atom("_NET_WM_WINDOW_TYPE", false), C.XA_ATOM, 32,
+		C.PropModeReplace, (*C.uchar)(unsafe.Pointer(&a)), 1)
+}
+
+// SetTransientFor sets the WM_TRANSIENT_FOR property of the window,
+// or deletes it if parent is zero.
+func (w *x11Window) SetTransientFor(parent uintptr) {
+	w.setTransientFor(parent)
+	C.XFlush(w.x)
+}
+
+func (w *x11Window) setTransientFor(parent uintptr) {
+	if parent == 0 {
+		C.XDeleteProperty(w.x, w.xw, C.XA_WM_TRANSIENT_FOR)
+		return
+	}
+	C.XSetTransientForHint(w.x, w.xw, C.Window(parent))
+}
+
+// SetUrgent sets or clears the urgency hint of the window, and the
+// corresponding _NET_WM_STATE_DEMANDS_ATTENTION state for EWMH
+// taskbars.
+func (w *x11Window) SetUrgent(urgent bool) {
+	w.mu.Lock()
+	changed := w.urgent != urgent
+	w.urgent = urgent
+	w.mu.Unlock()
+	if changed {
+		w.setUrgent(urgent)
+		C.XFlush(w.x)
+		w.wakeupQueued()
+	}
+}
+
+func (w *x11Window) setUrgent(urgent bool) {
+	hints := C.XGetWMHints(w.x, w.xw)
+	if hints == nil {
+		hints = C.XAllocWMHints()
+		if hints == nil {
+			return
+		}
+	}
+	defer C.XFree(unsafe.Pointer(hints))
+	hints.flags = C.long(x11UrgencyFlags(int64(hints.flags), urgent))
+	C.XSetWMHints(w.x, w.xw, hints)
+	w.sendWMState(urgent, w.atoms.wmStateDemandsAttention, 0)
+}
+
+// x11UrgencyFlags sets or clears the XUrgencyHint bit of
+// XWMHints flags.
+func x11UrgencyFlags(flags int64, urgent bool) int64 {
+	if urgent {
+		return flags | C.XUrgencyHint
+	}
+	return flags &^ C.XUrgencyHint
+}
+
+// SetDecorated sets the decorations field of the Motif window manager
+// hints. There is no EWMH equivalent, but the Motif hints are
+// understood by most window managers.
+func (w *x11Window) SetDecorated(decorated bool) {
+	w.setDecorated(decorated)
+	C.XFlush(w.x)
+}
+
+func (w *x11Window) setDecorated(decorated bool) {
+	const (
+		mwmHintsDecorations = 1 << 1
+		mwmDecorAll         = 1 << 0
+	)
+	var decor C.ulong
+	if decorated {
+		decor = mwmDecorAll
+	}
+	// flags, functions, decorations, input_mode and status.
+	hints := [5]C.ulong{mwmHintsDecorations, 0, decor, 0, 0}
+	C.XChangeProperty(w.x, w.xw, w.atoms.motifHints, w.atoms.motifHints, 32, C.PropModeReplace,
+		(*C.uchar)(unsafe.Pointer(&hints[0])), C.int(len(hints)))
+}
+
+// _NET_WM_MOVERESIZE directions.
+const (
+	x11SizeTopLeft = iota
+	x11SizeTop
+	x11SizeTopRight
+	x11SizeRight
+	x11SizeBottomRight
+	x11SizeBottom
+	x11SizeBottomLeft
+	x11SizeLeft
+	x11Move
+)
+
+// Move starts an interactive move of the window.
+func (w *x11Window) Move() {
+	w.moveResize(x11Move)
+}
+
+// Resize starts an interactive resize of the window edge or corner.
+func (w *x11Window) Resize(edge pointer.Edge) {
+	w.moveResize(x11ResizeDirection(edge))
+}
+
+// moveResize hands the pointer to the window manager for an
+// interactive move or resize, as described by _NET_WM_MOVERESIZE in
+// EWMH. It must be called while a pointer button is pressed.
+func (w *x11Window) moveResize(direction int) {
+	var root, child C.Window
+	var rootX, rootY, winX, winY C.int
+	var mask C.uint
+	C.XQueryPointer(w.x, w.xw, &root, &child, &rootX, &rootY, &winX, &winY, &mask)
+	w.wakeupQueued()
+	var button C.long
+	switch {
+	case mask&C.Button1Mask != 0:
+		button = C.Button1
+	case mask&C.Button2Mask != 0:
+		button = C.Button2
+	case mask&C.Button3Mask != 0:
+		button = C.Button3
+	default:
+		// The window manager would wait for a press
+		// that never comes.
+		return
+	}
+	// Release the implicit grab of the button press, so the
+	// window manager can grab the pointer.
+	C.XUngrabPointer(w.x, C.CurrentTime)
+	const sourceApplication = 1
+	data := [5]C.long{C.long(rootX), C.long(rootY), C.long(direction), button, sourceApplication}
+	w.sendClientMessage(root, w.xw, w.atoms.wmMoveResize, data, C.SubstructureNotifyMask|C.SubstructureRedirectMask)
+	C.XFlush(w.x)
+}
+
+// x11ResizeDirection returns the _NET_WM_MOVERESIZE direction
+// for resizing the edge.
+func x11ResizeDirection(edge pointer.Edge) int {
+	switch edge {
+	case pointer.EdgeTop:
+		return x11SizeTop
+	case pointer.EdgeBottom:
+		return x11SizeBottom
+	case pointer.EdgeLeft:
+		return x11SizeLeft
+	case pointer.EdgeRight:
+		return x11SizeRight
+	case pointer.EdgeTopLeft:
+		return x11SizeTopLeft
+	case pointer.EdgeTopRight:
+		return x11SizeTopRight
+	case pointer.EdgeBottomLeft:
+		return x11SizeBottomLeft
+	default:
+		return x11SizeBottomRight
+	}
+}
+
+// Iconify asks the window manager to minimize the window. The
+// window is paused until it is restored.
+func (w *x11Window) Iconify() {
+	C.XIconifyWindow(w.x, w.xw, C.XDefaultScreen(w.x))
+	C.XFlush(w.x)
+}
+
+// icccmState returns the ICCCM WM_STATE of the window.
+func (w *x11Window) icccmState() (int, bool) {
+	var (
+		typ        C.Atom
+		format     C.int
+		nitems     C.ulong
+		bytesAfter C.ulong
+		data       *C.uchar
+	)
+	if C.XGetWindowProperty(w.x, w.xw, w.atoms.icccmState, 0, 1, C.False, w.atoms.icccmState,
+		&typ, &format, &nitems, &bytesAfter, &data) != C.Success {
+		return 0, false
+	}
+	if data == nil {
+		return 0, false
+	}
+	defer C.XFree(unsafe.Pointer(data))
+	if format != 32 || nitems < 1 {
+		return 0, false
+	}
+	return int(*(*C.long)(unsafe.Pointer(data))), true
+}
+
+// x11StageForState returns the stage of a window in an ICCCM
+// WM_STATE. Iconified windows are paused.
+func x11StageForState(state int) (system.Stage, bool) {
+	switch state {
+	case x11NormalState:
+		return system.StageRunning, true
+	case x11IconicState:
+		return system.StagePaused, true
+	default:
+		// Withdrawn windows are about to be destroyed.
+		return 0, false
+	}
+}
+
+// sendWMState asks the window manager to add or remove one or two
+// _NET_WM_STATE properties of the window.
+func (w *x11Window) sendWMState(add bool, prop1, prop2 C.Atom) {
+	const (
+		_NET_WM_STATE_REMOVE = 0
+		_NET_WM_STATE_ADD    = 1
+		// sourceApplication marks the request as coming from
+		// a normal application.
+		sourceApplication = 1
+	)
+	action := C.long(_NET_WM_STATE_REMOVE)
+	if add {
+		action = _NET_WM_STATE_ADD
+	}
+	data := [5]C.long{action, C.long(prop1), C.long(prop2), sourceApplication}
+	root := C.XDefaultRootWindow(w.x)
+	w.sendClientMessage(root, w.xw, w.atoms.wmState, data, C.SubstructureNotifyMask|C.SubstructureRedirectMask)
+}
+
+// sendClientMessage sends a format 32 client message about
+// win to the dst window.
+func (w *x11Window) sendClientMessage(dst, win C.Window, typ C.Atom, data [5]C.long, mask C.long) {
+	var xev C.XEvent
+	cevt := (*C.XClientMessageEvent)(unsafe.Pointer(&xev))
+	*cevt = C.XClientMessageEvent{
+		_type:        C.ClientMessage,
+		display:      w.x,
+		window:       win,
+		message_type: typ,
+		format:       32,
+	}
+	*(*[5]C.long)(unsafe.Pointer(&cevt.data)) = data
+	C.XSendEvent(w.x, dst, C.False, mask, &xev)
+}
+
+// wmState returns the _NET_WM_STATE atoms of the window.
+func (w *x11Window) wmState() []C.Atom {
+	return w.readAtoms(w.xw, w.atoms.wmState)
+}
+
+// readAtoms reads an atom list property of a window.
+func (w *x11Window) readAtoms(win C.Window, prop C.Atom) []C.Atom {
+	longs := w.readLongs(win, prop, C.XA_ATOM)
+	if len(longs) == 0 {
+		return nil
+	}
+	atoms := make([]C.Atom, len(longs))
+	for i, v := range longs {
+		atoms[i] = C.Atom(v)
+	}
+	return atoms
+}
+
+// x11MaxLongs bounds the number of items read by readLongs, because
+// other clients control properties such as the XDND type list.
+const x11MaxLongs = 1 << 16
+
+// readLongs reads up to x11MaxLongs items of a format 32 property of
+// type typ.
+func (w *x11Window) readLongs(win C.Window, prop, typ C.Atom) []C.ulong {
+	var (
+		actualType C.Atom
+		format     C.int
+		nitems     C.ulong
+		bytesAfter C.ulong
+		data       *C.uchar
+	)
+	if C.XGetWindowProperty(w.x, win, prop, 0, x11MaxLongs, C.False, typ,
+		&actualType, &format, &nitems, &bytesAfter, &data) != C.Success {
+		return nil
+	}
+	if data == nil {
+		return nil
+	}
+	defer C.XFree(unsafe.Pointer(data))
+	if actualType != typ || format != 32 {
+		return nil
+	}
+	// Format 32 properties are returned as arrays of longs.
+	longs := (*[x11MaxLongs]C.ulong)(unsafe.Pointer(data))[:nitems:nitems]
+	return append([]C.ulong(nil), longs...)
+}
+
+// updateWMState tracks the _NET_WM_STATE changes made by the
+// window manager.
+func (w *x11Window) updateWMState() {
+	var horz, vert, full, above bool
+	for _, a := range w.wmState() {
+		switch a {
+		case w.atoms.wmStateAbove:
+			above = true
+		case w.atoms.wmStateMaxHorz:
+			horz = true
+		case w.atoms.wmStateMaxVert:
+			vert = true
+		case w.atoms.wmStateFullscreen:
+			full = true
+		}
+	}
+	maximized := horz && vert
+	w.mu.Lock()
+	w.fullscreen = full
+	changed := w.maximized != maximized
+	w.maximized = maximized
+	aboveChanged := w.above != above
+	w.above = above
+	w.mu.Unlock()
+	if changed {
+		w.w.Event(MaximizeEvent{Maximized: maximized})
+	}
+	if aboveChanged {
+		w.w.Event(AlwaysOnTopEvent{AlwaysOnTop: above})
+	}
+}
+
+// x11Cursor describes the X cursor of a pointer.CursorName.
+type x11Cursor struct {
+	// names lists the cursor theme names in order of preference.
+	names []string
+	// shape is the cursor font shape used without a theme.
+	shape C.uint
+}
+
+// x11Cursors maps cursor names to X cursors. Themes use the CSS
+// names, or the names of the cursor font for older themes.
+var x11Cursors = map[pointer.CursorName]x11Cursor{
+	pointer.CursorText:      {[]string{"text", "xterm"}, C.XC_xterm},
+	pointer.CursorPointer:   {[]string{"pointer", "hand2"}, C.XC_hand2},
+	pointer.CursorCrossHair: {[]string{"crosshair"}, C.XC_crosshair},
+	pointer.CursorColResize: {[]string{"col-resize", "sb_h_double_arrow"}, C.XC_sb_h_double_arrow},
+	pointer.CursorRowResize: {[]string{"row-resize", "sb_v_double_arrow"}, C.XC_sb_v_double_arrow},
+}
+
+// SetCursor sets the cursor shown over the window. The cursor of
+// CursorDefault and unknown names is inherited from the root window.
+func (w *x11Window) SetCursor(name pointer.CursorName) {
+	xc, ok := x11Cursors[name]
+	if !ok {
+		C.XUndefineCursor(w.x, w.xw)
+		C.XFlush(w.x)
+		return
+	}
+	w.mu.Lock()
+	c, ok := w.cursors[name]
+	if !ok {
+		c = C.Cursor(x11LoadCursor(xc.names, func(name string) uintptr {
+			cname := C.CString(name)
+			defer C.free(unsafe.Pointer(cname))
+			return uintptr(C.XcursorLibraryLoadCursor(w.x, cname))
+		}, func() uintptr {
+			return uintptr(C.XCreateFontCursor(w.x, xc.shape))
+		}))
+		if w.cursors == nil {
+			w.cursors = make(map[pointer.CursorName]C.Cursor)
+		}
+		w.cursors[name] = c
+	}
+	w.mu.Unlock()
+	C.XDefineCursor(w.x, w.xw, c)
+	C.XFlush(w.x)
+}
+
+// SetPos moves the top left corner of the window decorations to
+// (x, y). The position is marked as user specified in the size
+// hints, but the window is not override-redirect and window
+// managers may still ignore it.
+func (w *x11Window) SetPos(x, y int) {
+	w.mu.Lock()
+	// The window is moved with static gravity, which places
+	// the window itself and not its frame.
+	pos := image.Pt(x+w.extents.Left, y+w.extents.Top)
+	w.sizeHints.pos = pos
+	w.sizeHints.hasPos = true
+	w.mu.Unlock()
+	w.updateSizeHints()
+	C.XMoveWindow(w.x, w.xw, C.int(pos.X), C.int(pos.Y))
+	C.XFlush(w.x)
+}
+
+// updateFrameExtents reads the _NET_FRAME_EXTENTS property set
+// by the window manager.
+func (w *x11Window) updateFrameExtents() {
+	var e FrameExtentsEvent
+	if v := w.readLongs(w.xw, w.atoms.frameExtents, C.XA_CARDINAL); len(v) == 4 {
+		e = FrameExtentsEvent{Left: int(v[0]), Right: int(v[1]), Top: int(v[2]), Bottom: int(v[3])}
+	}
+	w.mu.Lock()
+	changed := w.extents != e
+	w.extents = e
+	w.mu.Unlock()
+	if changed {
+		w.w.Event(e)
+		w.updateBounds(w.pos)
+	}
+}
+
+// updateBounds reports the window rectangle for a window
+// with its top left corner at pos in root coordinates.
+func (w *x11Window) updateBounds(pos image.Point) {
+	w.pos = pos
+	w.mu.Lock()
+	e := w.extents
+	w.mu.Unlock()
+	b := image.Rectangle{
+		Min: pos.Sub(image.Pt(e.Left, e.Top)),
+		Max: pos.Add(image.Pt(w.width+e.Right, w.height+e.Bottom)),
+	}
+	if b != w.bounds {
+		w.bounds = b
+		w.w.Event(BoundsEvent{Bounds: b})
+	}
+}
+
+// rootPos returns the position of the window in root coordinates.
+func (w *x11Window) rootPos() image.Point {
+	var x, y C.int
+	var child C.Window
+	C.XTranslateCoordinates(w.x, w.xw, C.XDefaultRootWindow(w.x), 0, 0, &x, &y, &child)
+	return image.Pt(int(x), int(y))
+}
+
+// windowSize queries the size of the window from the X server.
+func (w *x11Window) windowSize() (image.Point, bool) {
+	var attrs C.XWindowAttributes
+	if C.XGetWindowAttributes(w.x, w.xw, &attrs) == 0 {
+		return image.Point{}, false
+	}
+	return image.Pt(int(attrs.width), int(attrs.height)), true
+}
+
+// SetMinMaxSize updates the size constraints of the window.
+func (w *x11Window) SetMinMaxSize(minWidth, minHeight, maxWidth, maxHeight unit.Value) {
+	w.mu.Lock()
+	w.sizeHints.minWidth, w.sizeHints.minHeight = minWidth, minHeight
+	w.sizeHints.maxWidth, w.sizeHints.maxHeight = maxWidth, maxHeight
+	w.mu.Unlock()
+	w.updateSizeHints()
+	C.XFlush(w.x)
+}
+
+// setClassHint sets the WM_CLASS property used by window managers
+// for window rules. The instance name is the program name as
+// described by ICCCM, and class defaults to the program name.
+func (w *x11Window) setClassHint(class string) {
+	name := os.Getenv("RESOURCE_NAME")
+	if name == "" {
+		name = filepath.Base(os.Args[0])
+	}
+	if class == "" {
+		class = filepath.Base(os.Args[0])
+	}
+	hint := C.XClassHint{
+		res_name:  C.CString(name),
+		res_class: C.CString(class),
+	}
+	defer C.free(unsafe.Pointer(hint.res_name))
+	defer C.free(unsafe.Pointer(hint.res_class))
+	C.XSetClassHint(w.x, w.xw, &hint)
+}
+
+// setRole sets the WM_WINDOW_ROLE property, used by session
+// managers to identify the window across sessions.
+func (w *x11Window) setRole(role string) {
+	if role == "" {
+		return
+	}
+	crole := C.CString(role)
+	defer C.free(unsafe.Pointer(crole))
+	C.XChangeProperty(w.x, w.xw, w.atom("WM_WINDOW_ROLE", false), C.XA_STRING, 8, C.PropModeReplace,
+		(*C.uchar)(unsafe.Pointer(crole)), C.int(len(role)))
+}
+
+// setProcessHints sets the _NET_WM_PID and WM_CLIENT_MACHINE
+// properties, for window managers to identify the process of the
+// window, such as to kill an unresponsive program.
+func (w *x11Window) setProcessHints() {
+	// The process ID is meaningless without the machine it
+	// runs on.
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return
+	}
+	chost := C.CString(host)
+	defer C.free(unsafe.Pointer(chost))
+	C.XChangeProperty(w.x, w.xw, C.XA_WM_CLIENT_MACHINE, C.XA_STRING, 8, C.PropModeReplace,
+		(*C.uchar)(unsafe.Pointer(chost)), C.int(len(host)))
+	pid := C.ulong(os.Getpid())
+	C.XChangeProperty(w.x, w.xw, w.atom("_NET_WM_PID", false), C.XA_CARDINAL, 32, C.PropModeReplace,
+		(*C.uchar)(unsafe.Pointer(&pid)), 1)
+}
+
+// x11StartupMessage returns the startup notification message
+// that ends the launch sequence with the given ID. Values with
+// spaces, quotes or backslashes are quoted as described by the
+// startup notification specification.
+func x11StartupMessage(id string) string {
+	if strings.ContainsAny(id, " \"\\") {
+		r := strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+		id = `"` + r.Replace(id) + `"`
+	}
+	return "remove: ID=" + id
+}
+
+// x11StartupChunks splits a nul-terminated startup notification
+// message into the 20 byte pieces carried by client messages.
+func x11StartupChunks(msg string) [][20]byte {
+	b := append([]byte(msg), 0)
+	var chunks [][20]byte
+	for len(b) > 0 {
+		var c [20]byte
+		n := copy(c[:], b)
+		b = b[n:]
+		chunks = append(chunks, c)
+	}
+	return chunks
+}
+
+// completeStartup sets the _NET_STARTUP_ID property from the
+// DESKTOP_STARTUP_ID environment variable and tells the desktop
+// that the launch is complete. The variable is cleared so that
+// other windows and child processes don't reuse the ID.
+func (w *x11Window) completeStartup() {
+	id := os.Getenv("DESKTOP_STARTUP_ID")
+	if id == "" {
+		return
+	}
+	os.Unsetenv("DESKTOP_STARTUP_ID")
+	cid := C.CString(id)
+	defer C.free(unsafe.Pointer(cid))
+	C.XChangeProperty(w.x, w.xw, w.atom("_NET_STARTUP_ID", false), w.atoms.utf8string, 8,
+		C.PropModeReplace, (*C.uchar)(unsafe.Pointer(cid)), C.int(len(id)))
+	begin := w.atom("_NET_STARTUP_INFO_BEGIN", false)
+	info := w.atom("_NET_STARTUP_INFO", false)
+	root := C.XDefaultRootWindow(w.x)
+	for i, c := range x11StartupChunks(x11StartupMessage(id)) {
+		typ := info
+		if i == 0 {
+			typ = begin
+		}
+		var xev C.XEvent
+		cevt := (*C.XClientMessageEvent)(unsafe.Pointer(&xev))
+		*cevt = C.XClientMessageEvent{
+			_type:        C.ClientMessage,
+			display:      w.x,
+			window:       w.xw,
+			message_type: typ,
+			format:       8,
+		}
+		*(*[20]byte)(unsafe.Pointer(&cevt.data)) = c
+		C.XSendEvent(w.x, root, C.False, C.PropertyChangeMask, &xev)
+	}
+}
+
+// updateSizeHints converts the size constraints to pixels
+// and sets the WM_NORMAL_HINTS property of the window.
+func (w *x11Window) updateSizeHints() {
+	w.mu.Lock()
+	cfg := w.cfg
+	sh := w.sizeHints
+	w.mu.Unlock()
+	var hints C.XSizeHints
+	if sh.minWidth.V > 0 || sh.minHeight.V > 0 {
+		hints.flags |= C.PMinSize
+		hints.min_width = C.int(cfg.Px(sh.minWidth))
+		hints.min_height = C.int(cfg.Px(sh.minHeight))
+	}
+	if sh.maxWidth.V > 0 || sh.maxHeight.V > 0 {
+		hints.flags |= C.PMaxSize
+		// Zero means unconstrained, which is the largest
+		// possible size for the window manager.
+		hints.max_width, hints.max_height = math.MaxInt16, math.MaxInt16
+		if sh.maxWidth.V > 0 {
+			hints.max_width = C.int(cfg.Px(sh.maxWidth))
+		}
+		if sh.maxHeight.V > 0 {
+			hints.max_height = C.int(cfg.Px(sh.maxHeight))
+		}
+	}
+	if sh.fixed {
+		// Equal minimum and maximum sizes disable resizing.
+		hints.flags |= C.PMinSize | C.PMaxSize
+		hints.min_width = C.int(cfg.Px(sh.width))
+		hints.min_height = C.int(cfg.Px(sh.height))
+		hints.max_width, hints.max_height = hints.min_width, hints.min_height
+	}
+	if sh.hasPos {
+		hints.flags |= C.USPosition | C.PWinGravity
+		hints.x, hints.y = C.int(sh.pos.X), C.int(sh.pos.Y)
+		hints.win_gravity = C.StaticGravity
+	}
+	C.XSetWMNormalHints(w.x, w.xw, &hints)
+}
+
+// SetIcon sets the _NET_WM_ICON property of the window.
+func (w *x11Window) SetIcon(icon []image.Image) {
+	w.setIcon(icon)
+	C.XFlush(w.x)
+}
+
+func (w *x11Window) setIcon(icon []image.Image) {
+	data := x11IconData(icon)
+	if len(data) == 0 {
+		C.XDeleteProperty(w.x, w.xw, w.atoms.wmIcon)
+		return
+	}
+	// Xlib expects format 32 properties as arrays of longs.
+	longs := make([]C.ulong, len(data))
+	for i, v := range data {
+		longs[i] = C.ulong(v)
+	}
+	C.XChangeProperty(w.x, w.xw, w.atoms.wmIcon, C.XA_CARDINAL, 32, C.PropModeReplace,
+		(*C.uchar)(unsafe.Pointer(&longs[0])), C.int(len(longs)))
+}
+
+// SetOpacity sets the _NET_WM_WINDOW_OPACITY property of the window.
+// Without a compositor, the property has no effect.
+func (w *x11Window) SetOpacity(opacity float32) {
+	w.setOpacity(opacity)
+	C.XFlush(w.x)
+}
+
+func (w *x11Window) setOpacity(opacity float32) {
+	v := x11Opacity(opacity)
+	if v == math.MaxUint32 {
+		// A missing property means opaque.
+		C.XDeleteProperty(w.x, w.xw, w.atoms.wmOpacity)
+		return
+	}
+	// Xlib expects format 32 properties as arrays of longs.
+	long := C.ulong(v)
+	C.XChangeProperty(w.x, w.xw, w.atoms.wmOpacity, C.XA_CARDINAL, 32, C.PropModeReplace,
+		(*C.uchar)(unsafe.Pointer(&long)), 1)
+}
+
+// x11Opacity converts an opacity between 0 and 1 to the
+// _NET_WM_WINDOW_OPACITY cardinal, where 0xffffffff is opaque.
+func x11Opacity(opacity float32) uint32 {
+	switch {
+	case opacity <= 0:
+		return 0
+	case opacity >= 1:
+		return math.MaxUint32
+	}
+	return uint32(math.Round(float64(opacity) * math.MaxUint32))
+}
+
+// x11IconData encodes images in the _NET_WM_ICON format: for each image
+// its width and height followed by its pixels, row by row, as
+// non-premultiplied ARGB values.
+func x11IconData(icon []image.Image) []uint32 {
+	var data []uint32
+	for _, img := range icon {
+		b := img.Bounds()
+		if b.Empty() {
+			continue
+		}
+		data = append(data, uint32(b.Dx()), uint32(b.Dy()))
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				data = append(data, uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+			}
+		}
+	}
+	return data
+}
+
+// x11Selection is the content of a selection owned by a window.
+type x11Selection struct {
+	mime string
+	data []byte
+	// serial is the sequence number of the request that took
+	// ownership of the selection.
+	serial C.ulong
+}
+
+// clearSelection forgets the content of the selection lost in cevt,
+// and reports whether it was the CLIPBOARD. The window may have taken
+// the selection back by a request the server had not processed when
+// it sent the event, whose serial is then earlier.
+func (w *x11Window) clearSelection(cevt *C.XSelectionClearEvent) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var sel *x11Selection
+	switch cevt.selection {
+	case C.XA_PRIMARY:
+		sel = &w.primary
+	case w.atoms.clipboard:
+		sel = &w.clipboard
+	default:
+		return false
+	}
+	if cevt.serial < sel.serial {
+		return false
+	}
+	*sel = x11Selection{}
+	return cevt.selection == w.atoms.clipboard
+}
+
+// x11TextMIME is the MIME type of text content.
+const x11TextMIME = "text/plain;charset=utf-8"
+
+// x11IsText reports whether a MIME type or target name
+// denotes UTF-8 text.
+func x11IsText(mime string) bool {
+	switch mime {
+	case x11TextMIME, "text/plain", "UTF8_STRING":
+		return true
+	}
+	return false
+}
+
+// x11MIMETargets returns the names of the selection targets that
+// serve content of a MIME type. Targets are named after MIME types,
+// except for the UTF8_STRING target of text.
+func x11MIMETargets(mime string) []string {
+	switch {
+	case mime == "":
+		return nil
+	case x11IsText(mime):
+		return []string{"UTF8_STRING", x11TextMIME, "text/plain"}
+	default:
+		return []string{mime}
+	}
+}
+
+// ReadClipboard requests the text content of the CLIPBOARD
+// selection. The content is delivered asynchronously as a
+// system.ClipboardEvent.
+func (w *x11Window) ReadClipboard() {
+	w.ReadClipboardMIME(x11TextMIME)
+}
+
+// ReadClipboardMIME is like ReadClipboard for content of
+// any MIME type. The read fails with gocontext.DeadlineExceeded
+// if the owner doesn't respond within x11SelectionTimeout.
+func (w *x11Window) ReadClipboardMIME(mime string) {
+	w.readClipboard(gocontext.Background(), x11SelectionTimeout, mime)
+}
+
+// ReadClipboardContext is like ReadClipboardMIME, except that the
+// read fails with the error of ctx when it is done.
+func (w *x11Window) ReadClipboardContext(ctx gocontext.Context, mime string) {
+	w.readClipboard(ctx, 0, mime)
+}
+
+func (w *x11Window) readClipboard(ctx gocontext.Context, timeout time.Duration, mime string) {
+	w.startSelectionRead(ctx, timeout, w.atoms.clipboardContent, mime)
+	C.XDeleteProperty(w.x, w.xw, w.atoms.clipboardContent)
+	// Ask for the supported targets first; the content is requested
+	// when they arrive.
+	C.XConvertSelection(w.x, w.atoms.clipboard, w.atoms.targets, w.atoms.clipboardContent, w.xw, C.CurrentTime)
+	C.XFlush(w.x)
+}
+
+// readPrimary requests the PRIMARY selection. The content is
+// delivered as a system.PrimarySelectionEvent.
+func (w *x11Window) readPrimary(t C.Time) {
+	w.startSelectionRead(gocontext.Background(), x11SelectionTimeout, w.atoms.primaryContent, x11TextMIME)
+	C.XDeleteProperty(w.x, w.xw, w.atoms.primaryContent)
+	C.XConvertSelection(w.x, C.XA_PRIMARY, w.atoms.targets, w.atoms.primaryContent, w.xw, t)
+	C.XFlush(w.x)
+}
+
+// x11SelectionTimeout is the time selection owners have to
+// respond to a read.
+const x11SelectionTimeout = 5 * time.Second
+
+// x11SelectionRead is a pending read of a selection.
+type x11SelectionRead struct {
+	// mime is the requested type of the content.
+	mime string
+	// cancel releases the context of the read.
+	cancel gocontext.CancelFunc
+	// err is set when the context is done before the
+	// read completes.
+	err error
+}
+
+// startSelectionRead tracks a read with its content in prop, replacing
+// any pending read of prop. The read expires when ctx is done, or
+// after timeout if it is not zero. Expired reads are reported by
+// expireSelectionReads.
+func (w *x11Window) startSelectionRead(ctx gocontext.Context, timeout time.Duration, prop C.Atom, mime string) {
+	var cancel gocontext.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = gocontext.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = gocontext.WithCancel(ctx)
+	}
+	r := &x11SelectionRead{mime: mime, cancel: cancel}
+	w.mu.Lock()
+	if old := w.selectionReads[prop]; old != nil {
+		old.cancel()
+	}
+	if w.selectionReads == nil {
+		w.selectionReads = make(map[C.Atom]*x11SelectionRead)
+	}
+	w.selectionReads[prop] = r
+	w.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		// Completed and replaced reads are no longer tracked.
+		if w.selectionReads[prop] == r {
+			r.err = ctx.Err()
+			w.wakeup()
+		}
+	}()
+}
+
+// pendingSelectionRead returns the pending read of prop, or nil.
+func (w *x11Window) pendingSelectionRead(prop C.Atom) *x11SelectionRead {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.selectionReads[prop]
+}
+
+// finishSelectionRead stops tracking the read of prop.
+func (w *x11Window) finishSelectionRead(prop C.Atom) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if r := w.selectionReads[prop]; r != nil {
+		delete(w.selectionReads, prop)
+		r.cancel()
+	}
+}
+
+// expireSelectionReads stops tracking expired reads and reports
+// failed clipboard reads. Replies that arrive later are ignored.
+func (w *x11Window) expireSelectionReads() {
+	var errs []error
+	w.mu.Lock()
+	for prop, r := range w.selectionReads {
+		if r.err == nil {
+			continue
+		}
+		delete(w.selectionReads, prop)
+		r.cancel()
+		// Failed reads of PRIMARY are not reported.
+		if prop == w.atoms.clipboardContent {
+			errs = append(errs, r.err)
+		}
+	}
+	w.mu.Unlock()
+	for _, err := range errs {
+		w.w.Event(system.ClipboardEvent{Err: err})
+	}
+}
+
+// textTargets returns the supported text targets of selections, in
+// order of preference.
+func (w *x11Window) textTargets() []C.Atom {
+	return []C.Atom{w.atoms.utf8string, C.XA_STRING, w.atoms.textPlain}
+}
+
+// convertSelection requests the content of a selection in the best
+// target for mime offered by the owner, in reply to the TARGETS
+// request cevt. It reports false if no target is supported.
+func (w *x11Window) convertSelection(cevt *C.XSelectionEvent, mime string) bool {
+	prefs := []C.Atom{w.atom(mime, false)}
+	if x11IsText(mime) {
+		prefs = w.textTargets()
+	}
+	target := prefs[0]
+	// A None property means that the owner doesn't support
+	// TARGETS; try the preferred target regardless.
+	if cevt.property != C.None {
+		offered := w.readAtoms(w.xw, cevt.property)
+		i := x11BestTarget(atomValues(offered), atomValues(prefs))
+		if i == -1 {
+			return false
+		}
+		target = prefs[i]
+	}
+	C.XConvertSelection(w.x, cevt.selection, target, cevt.property, w.xw, cevt.time)
+	C.XFlush(w.x)
+	return true
+}
+
+func atomValues(atoms []C.Atom) []uint64 {
+	vals := make([]uint64, len(atoms))
+	for i, a := range atoms {
+		vals[i] = uint64(a)
+	}
+	return vals
+}
+
+// x11BestTarget returns the index of the first target in prefs
+// that is offered, or -1 if there is none.
+func x11BestTarget(offered, prefs []uint64) int {
+	for i, p := range prefs {
+		for _, o := range offered {
+			if o == p {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// x11Latin1ToUTF8 converts the ISO Latin-1 text of the STRING
+// target to UTF-8.
+func x11Latin1ToUTF8(latin1 []byte) string {
+	runes := make([]rune, len(latin1))
+	for i, b := range latin1 {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// SetPrimarySelection takes ownership of the PRIMARY selection
+// and serves s to other clients.
+func (w *x11Window) SetPrimarySelection(s string) {
+	w.mu.Lock()
+	w.primary = x11Selection{mime: x11TextMIME, data: []byte(s), serial: C.XNextRequest(w.x)}
+	w.mu.Unlock()
+	C.XSetSelectionOwner(w.x, C.XA_PRIMARY, w.xw, C.CurrentTime)
+	C.XFlush(w.x)
+}
+
+// WriteClipboard takes ownership of the CLIPBOARD selection and serves
+// s to requestors until another client takes over. A
+// system.ClipboardLostEvent is sent when that happens.
+//
+// Transfers are done in a single property change; the INCR protocol
+// is not supported, so content larger than the maximum request size of
+// the X server is refused.
+func (w *x11Window) WriteClipboard(s string) {
+	w.WriteClipboardMIME(x11TextMIME, []byte(s))
+}
+
+// WriteClipboardMIME is like WriteClipboard for content of
+// any MIME type.
+func (w *x11Window) WriteClipboardMIME(mime string, data []byte) {
+	w.mu.Lock()
+	w.clipboard = x11Selection{mime: mime, data: data, serial: C.XNextRequest(w.x)}
+	w.mu.Unlock()
+	C.XSetSelectionOwner(w.x, w.atoms.clipboard, w.xw, C.CurrentTime)
+	C.XFlush(w.x)
+}
+
+func (w *x11Window) setTitle(title string) {
+	ctitle := C.CString(title)
+	defer C.free(unsafe.Pointer(ctitle))
+	C.XStoreName(w.x, w.xw, ctitle)
+	// set _NET_WM_NAME as well for UTF-8 support in window title.
+	C.XSetTextProperty(w.x, w.xw,
+		&C.XTextProperty{
+			value:    (*C.uchar)(unsafe.Pointer(ctitle)),
+			encoding: w.atoms.utf8string,
+			format:   8,
+			nitems:   C.ulong(len(title)),
+		},
+		w.atoms.wmName)
+}
+
 var x11OneByte = make([]byte, 1)
 
+// wakeupQueued wakes up the event loop if Xlib has queued events,
+// which the poll of the loop doesn't see.
+func (w *x11Window) wakeupQueued() {
+	if C.XEventsQueued(w.x, C.QueuedAlready) > 0 {
+		w.wakeup()
+	}
+}
+
 func (w *x11Window) wakeup() {
 	if _, err := syscall.Write(w.notify.write, x11OneByte); err != nil && err != syscall.EAGAIN {
 		panic(fmt.Errorf("failed to write to pipe: %v", err))
@@ -82,10 +1824,43 @@ func (w *x11Window) display() *C.Display {
 	return w.x
 }
 
+// NativeWindow returns the Xlib Display and the window XID. Both
+// are fixed for the lifetime of the window.
+func (w *x11Window) NativeWindow() (unsafe.Pointer, uintptr) {
+	return unsafe.Pointer(w.x), uintptr(w.xw)
+}
+
 func (w *x11Window) window() (C.Window, int, int) {
 	return w.xw, w.width, w.height
 }
 
+// updateStage pauses the window while it is hidden. It reports
+// whether the window started running again.
+func (w *x11Window) updateStage() bool {
+	w.updateVisibility()
+	v := w.visibility
+	if v.iconic || v.unmapped || v.obscured {
+		w.setStage(system.StagePaused)
+		return false
+	}
+	resumed := w.stage == system.StagePaused
+	w.setStage(system.StageRunning)
+	return resumed
+}
+
+// updateVisibility reports changes of the visibility of the window
+// as a system.VisibilityEvent.
+func (w *x11Window) updateVisibility() {
+	v := &w.visibility
+	e := system.VisibilityEvent{Visible: v.mapped && !v.iconic}
+	e.Obscured = e.Visible && v.obscured
+	if e == v.reported {
+		return
+	}
+	v.reported = e
+	w.w.Event(e)
+}
+
 func (w *x11Window) setStage(s system.Stage) {
 	if s == w.stage {
 		return
@@ -95,17 +1870,21 @@ func (w *x11Window) setStage(s system.Stage) {
 }
 
 func (w *x11Window) loop() {
-	h := x11EventHandler{w: w, xev: new(C.XEvent), text: make([]byte, 4)}
+	h := newX11EventHandler(w)
 	xfd := C.XConnectionNumber(w.x)
 
 	// Poll for events and notifications.
 	pollfds := []syscall.PollFd{
-		{Fd: int32(xfd), Events: syscall.POLLIN | syscall.POLLERR},
+		{Fd: int32(xfd), Events: syscall.POLLIN | syscall.POLLERR | syscall.POLLHUP},
 		{Fd: int32(w.notify.read), Events: syscall.POLLIN | syscall.POLLERR},
 	}
 	xEvents := &pollfds[0].Revents
 	// Plenty of room for a backlog of notifications.
 	buf := make([]byte, 100)
+	// deferred is set while a frame is delayed by the
+	// frame rate limit.
+	deferred := false
+	var lastFrame time.Time
 
 loop:
 	for !w.dead {
@@ -116,24 +1895,39 @@ loop:
 		if syn = h.handleEvents(); !syn {
 			w.mu.Lock()
 			animating := w.animating
+			wakeupAt := w.wakeupAt
 			w.mu.Unlock()
-			if animating {
+			delay := x11FrameDelay(lastFrame, time.Now(), w.frameInterval)
+			// Paused windows are not drawn; wait for them to resume.
+			animating = animating && w.stage == system.StageRunning
+			if animating && delay == 0 {
 				redraw = true
 			} else {
+				timeout := -1
+				if animating || deferred {
+					// Wait for the next frame, rounding up to
+					// whole milliseconds.
+					timeout = int((delay + time.Millisecond - 1) / time.Millisecond)
+				}
+				timeout = x11PollTimeout(timeout, wakeupAt, time.Now())
 				// Clear poll events.
 				*xEvents = 0
 				// Wait for X event or gio notification.
-				if _, err := syscall.Poll(pollfds, -1); err != nil && err != syscall.EINTR {
+				if _, err := syscall.Poll(pollfds, timeout); err != nil && err != syscall.EINTR {
 					panic(fmt.Errorf("x11 loop: poll failed: %w", err))
 				}
-				switch {
-				case *xEvents&syscall.POLLIN != 0:
+				// Check for errors first, because a hangup is also
+				// reported as readable and Xlib exits the process on
+				// I/O errors if its exit handler can't be replaced.
+				if err := x11PollError(*xEvents); err != nil {
+					w.connErr = err
+					break loop
+				}
+				if *xEvents&syscall.POLLIN != 0 {
 					syn = h.handleEvents()
 					if w.dead {
 						break loop
 					}
-				case *xEvents&(syscall.POLLERR|syscall.POLLHUP) != 0:
-					break loop
 				}
 			}
 		}
@@ -146,11 +1940,47 @@ loop:
 			if err != nil {
 				panic(fmt.Errorf("x11 loop: read from notify pipe failed: %w", err))
 			}
+		}
+		if err := w.ioError(); err != nil {
+			w.connErr = err
+			break
+		}
+		w.expireSelectionReads()
+		w.mu.Lock()
+		closing := w.closing
+		if w.invalidated {
+			w.invalidated = false
+			redraw = true
+		}
+		if !w.wakeupAt.IsZero() && !time.Now().Before(w.wakeupAt) {
+			w.wakeupAt = time.Time{}
+			redraw = true
+		}
+		reload := w.resourcesChanged
+		if reload {
+			w.resourcesChanged = false
+			w.resourceTimer = nil
+		}
+		w.mu.Unlock()
+		if closing {
+			break
+		}
+		if reload && w.reloadResources() {
 			redraw = true
 		}
+		// Limit the rate of frames that are not required by
+		// the system.
+		if redraw || deferred {
+			redraw = x11FrameDelay(lastFrame, time.Now(), w.frameInterval) == 0
+			deferred = !redraw
+		}
 
 		if redraw || syn {
-			w.cfg.now = time.Now()
+			deferred = false
+			lastFrame = time.Now()
+			w.mu.Lock()
+			w.cfg.now = lastFrame
+			w.mu.Unlock()
 			w.w.Event(FrameEvent{
 				FrameEvent: system.FrameEvent{
 					Size: image.Point{
@@ -158,27 +1988,88 @@ loop:
 						Y: w.height,
 					},
 					Config: &w.cfg,
+					Damage: w.damage,
 				},
 				Sync: syn,
 			})
+			w.damage = image.Rectangle{}
+			// The frame is drawn when the event is acknowledged.
+			w.frameDone()
 		}
 	}
-	w.w.Event(system.DestroyEvent{Err: nil})
+	w.w.Event(system.DestroyEvent{Err: w.connErr})
+}
+
+// x11PollError returns the error for the poll events of
+// the X connection, or nil if the connection is intact.
+func x11PollError(revents int16) error {
+	switch {
+	case revents&syscall.POLLHUP != 0:
+		return errors.New("x11: the X server closed the connection")
+	case revents&syscall.POLLERR != 0:
+		return errors.New("x11: error on the X server connection")
+	case revents&syscall.POLLNVAL != 0:
+		return errors.New("x11: the X server connection is not open")
+	}
+	return nil
 }
 
 func (w *x11Window) destroy() {
-	if w.notify.write != 0 {
+	if w.x != nil {
+		x11WindowsMu.Lock()
+		delete(x11Windows, w.x)
+		x11WindowsMu.Unlock()
+	}
+	// Stop everything that may wake up the loop before closing
+	// the notification pipe.
+	w.mu.Lock()
+	for _, r := range w.selectionReads {
+		r.cancel()
+	}
+	w.selectionReads = nil
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+	if w.resourceTimer != nil {
+		w.resourceTimer.Stop()
+		w.resourceTimer = nil
+	}
+	w.mu.Unlock()
+	// Closed descriptors are -1, because 0 is a valid descriptor.
+	if w.notify.write != -1 {
 		syscall.Close(w.notify.write)
-		w.notify.write = 0
+		w.notify.write = -1
+	}
+	if w.notify.read != -1 {
+		syscall.Close(w.notify.read)
+		w.notify.read = -1
+	}
+	if w.xkb != nil {
+		w.xkb.Destroy()
+		w.xkb = nil
+	}
+	if w.connErr != nil {
+		// Any request to a lost server ends the process.
+		return
+	}
+	w.mu.Lock()
+	for _, c := range w.cursors {
+		C.XFreeCursor(w.x, c)
 	}
-	if w.notify.read != 0 {
-		syscall.Close(w.notify.read)
-		w.notify.read = 0
+	w.cursors = nil
+	hotkeys := w.hotkeys
+	w.hotkeys = nil
+	w.mu.Unlock()
+	if w.sync.counter != 0 {
+		C.XSyncDestroyCounter(w.x, w.sync.counter)
 	}
-	if w.xkb != nil {
-		w.xkb.Destroy()
-		w.xkb = nil
+	for hk := range hotkeys {
+		w.ungrabKey(hk)
 	}
+	w.ReleaseKeyboard()
+	w.ReleasePointer()
+	w.abortSelectionRequests()
 	C.XDestroyWindow(w.x, w.xw)
 	C.XCloseDisplay(w.x)
 }
@@ -206,6 +2097,69 @@ type x11EventHandler struct {
 	xev    *C.XEvent
 	status C.Status
 	keysym C.KeySym
+	// queue holds injected events that are handled before the
+	// events from the X server. It is a seam for testing
+	// handleEvents without a display.
+	queue []C.XEvent
+}
+
+func newX11EventHandler(w *x11Window) *x11EventHandler {
+	return &x11EventHandler{w: w, xev: new(C.XEvent), text: make([]byte, 4)}
+}
+
+// motionFollows reports whether the next queued event is a core
+// MotionNotify event, or an XI_Motion event if xi is set, which
+// supersedes the current motion event. The data of a queued XInput
+// event is not fetched, so emulated motion also counts. An injected
+// event is followed by the rest of the injected events.
+func (h *x11EventHandler) motionFollows(xi, injected bool) bool {
+	var next C.XEvent
+	switch {
+	case injected:
+		if len(h.queue) == 0 {
+			return false
+		}
+		next = h.queue[0]
+	case C.XEventsQueued(h.w.x, C.QueuedAfterReading) != 0:
+		C.XPeekEvent(h.w.x, &next)
+	default:
+		return false
+	}
+	_type := (*C.XAnyEvent)(unsafe.Pointer(&next))._type
+	if !xi {
+		return _type == C.MotionNotify
+	}
+	cookie := (*C.XGenericEventCookie)(unsafe.Pointer(&next))
+	return _type == C.GenericEvent && cookie.extension == h.w.xi2.opcode && cookie.evtype == C.XI_Motion
+}
+
+// x11StateButtons returns the buttons held according to the
+// button mask bits of an event state.
+func x11StateButtons(state uint) pointer.Buttons {
+	var btns pointer.Buttons
+	if state&C.Button1Mask != 0 {
+		btns |= pointer.ButtonLeft
+	}
+	if state&C.Button2Mask != 0 {
+		btns |= pointer.ButtonMiddle
+	}
+	if state&C.Button3Mask != 0 {
+		btns |= pointer.ButtonRight
+	}
+	return btns
+}
+
+// isRepeatRelease reports whether a KeyRelease is immediately followed
+// by a press of the same key at the same time, which is how the X server
+// reports auto-repeat without detectable auto-repeat.
+func (h *x11EventHandler) isRepeatRelease(kevt *C.XKeyEvent) bool {
+	if C.XEventsQueued(h.w.x, C.QueuedAfterReading) == 0 {
+		return false
+	}
+	var next C.XEvent
+	C.XPeekEvent(h.w.x, &next)
+	nevt := (*C.XKeyEvent)(unsafe.Pointer(&next))
+	return nevt._type == C.KeyPress && nevt.keycode == kevt.keycode && nevt.time == kevt.time
 }
 
 // handleEvents returns true if the window needs to be redrawn.
@@ -214,12 +2168,40 @@ func (h *x11EventHandler) handleEvents() bool {
 	w := h.w
 	xev := h.xev
 	redraw := false
-	for C.XPending(w.x) != 0 {
-		C.XNextEvent(w.x, xev)
-		if C.XFilterEvent(xev, C.None) == C.True {
+	for {
+		injected := len(h.queue) > 0
+		if injected {
+			// Injected events bypass Xlib.
+			*xev = h.queue[0]
+			h.queue = h.queue[1:]
+		} else {
+			// Tests inject events without a display, and only
+			// the queue is handled then. The handling of the
+			// events themselves doesn't depend on the display.
+			if w.x == nil || C.XPending(w.x) == 0 {
+				break
+			}
+			C.XNextEvent(w.x, xev)
+			if C.XFilterEvent(xev, C.None) == C.True {
+				continue
+			}
+		}
+		_type := (*C.XAnyEvent)(unsafe.Pointer(xev))._type
+		if _type != C.KeyPress && _type != C.KeyRelease {
+			// Keep the order of coalesced text and other
+			// events.
+			w.flushEdit()
+		}
+		if w.compositorEvent(xev) {
+			continue
+		}
+		if w.randrEvent(xev) {
+			if w.updateMonitor(w.pos.Add(image.Pt(w.width/2, w.height/2))) {
+				redraw = true
+			}
 			continue
 		}
-		switch _type := (*C.XAnyEvent)(unsafe.Pointer(xev))._type; _type {
+		switch _type {
 		case h.w.xkbEventBase:
 			xkbEvent := (*C.XkbAnyEvent)(unsafe.Pointer(xev))
 			switch xkbEvent.xkb_type {
@@ -232,12 +2214,52 @@ func (h *x11EventHandler) handleEvents() bool {
 				h.w.xkb.UpdateMask(uint32(state.base_mods), uint32(state.latched_mods), uint32(state.locked_mods),
 					uint32(state.base_group), uint32(state.latched_group), uint32(state.locked_group))
 			}
+		case C.MappingNotify:
+			// Keep the keyboard mapping cached by Xlib current. Layout
+			// changes also arrive as XkbMapNotify and
+			// XkbNewKeyboardNotify events, which reload the xkb keymap
+			// and its modifier state from the server.
+			mevt := (*C.XMappingEvent)(unsafe.Pointer(xev))
+			if mevt.request != C.MappingPointer {
+				C.XRefreshKeyboardMapping(mevt)
+			}
 		case C.KeyPress:
 			kevt := (*C.XKeyPressedEvent)(unsafe.Pointer(xev))
-			for _, e := range h.w.xkb.DispatchKey(uint32(kevt.keycode)) {
-				w.w.Event(e)
+			if kevt.window != w.xw {
+				// Hotkeys are grabbed on the root window.
+				hk := x11Hotkey{keycode: kevt.keycode, state: kevt.state &^ x11LockMasks}
+				w.mu.Lock()
+				e, ok := w.hotkeys[hk]
+				w.mu.Unlock()
+				if ok {
+					w.keyEvent(e)
+				}
+				break
+			}
+			// A press of a key that is already down is an
+			// auto-repeat.
+			repeat := w.keysDown[kevt.keycode&0xff]
+			w.keysDown[kevt.keycode&0xff] = true
+			for _, e := range h.w.xkb.DispatchKey(uint32(kevt.keycode), key.Press) {
+				if ke, ok := e.(key.Event); ok {
+					ke.Repeat = repeat
+					e = ke
+				}
+				w.keyEvent(e)
 			}
 		case C.KeyRelease:
+			kevt := (*C.XKeyReleasedEvent)(unsafe.Pointer(xev))
+			if kevt.window != w.xw {
+				// Release of a hotkey.
+				break
+			}
+			if !w.detectableRepeat && h.isRepeatRelease(kevt) {
+				break
+			}
+			w.keysDown[kevt.keycode&0xff] = false
+			for _, e := range h.w.xkb.DispatchKey(uint32(kevt.keycode), key.Release) {
+				w.keyEvent(e)
+			}
 		case C.ButtonPress, C.ButtonRelease:
 			bevt := (*C.XButtonEvent)(unsafe.Pointer(xev))
 			ev := pointer.Event{
@@ -247,13 +2269,20 @@ func (h *x11EventHandler) handleEvents() bool {
 					X: float32(bevt.x),
 					Y: float32(bevt.y),
 				},
-				Time: time.Duration(bevt.time) * time.Millisecond,
+				Time:      time.Duration(bevt.time) * time.Millisecond,
+				Timestamp: w.clock.Time(uint32(bevt.time), time.Now()),
+				Modifiers: x11StateModifiers(uint(bevt.state)),
 			}
 			if bevt._type == C.ButtonRelease {
 				ev.Type = pointer.Release
 			}
+			// The raw event of a wheel button precedes the core
+			// event, and tells whether the scrolling is already
+			// reported by handleXIEvent.
+			if w.xi2.emulatedWheel && bevt.button >= C.Button4 && bevt.button <= 7 {
+				continue
+			}
 			var btn pointer.Buttons
-			const scrollScale = 10
 			switch bevt.button {
 			case C.Button1:
 				btn = pointer.ButtonLeft
@@ -264,205 +2293,1881 @@ func (h *x11EventHandler) handleEvents() bool {
 			case C.Button4:
 				// scroll up
 				ev.Type = pointer.Move
-				ev.Scroll.Y = -scrollScale
+				ev.Scroll.Y = -w.cfg.scrollScale
 			case C.Button5:
 				// scroll down
 				ev.Type = pointer.Move
-				ev.Scroll.Y = +scrollScale
+				ev.Scroll.Y = +w.cfg.scrollScale
+			case 6:
+				// Buttons 6 and 7 are horizontal scroll by convention.
+				// scroll left
+				ev.Type = pointer.Move
+				ev.Scroll.X = -w.cfg.scrollScale
+			case 7:
+				// scroll right
+				ev.Type = pointer.Move
+				ev.Scroll.X = +w.cfg.scrollScale
 			default:
 				continue
 			}
+			pos := image.Pt(int(bevt.x), int(bevt.y))
 			switch _type {
 			case C.ButtonPress:
 				w.pointerBtns |= btn
+				if btn != 0 {
+					ev.Clicks = w.clicks.press(btn, pos, ev.Time)
+				}
 			case C.ButtonRelease:
 				w.pointerBtns &^= btn
+				if btn != 0 {
+					ev.Clicks = w.clicks.count
+				}
 			}
 			ev.Buttons = w.pointerBtns
 			w.w.Event(ev)
+			if _type == C.ButtonRelease {
+				w.mu.Lock()
+				grabbed := w.pointerGrab
+				w.mu.Unlock()
+				if x11ReleaseGrab(grabbed, w.pointerBtns) {
+					w.ReleasePointer()
+				}
+			}
+			// Middle clicks paste the PRIMARY selection.
+			if _type == C.ButtonRelease && btn == pointer.ButtonMiddle {
+				w.readPrimary(bevt.time)
+			}
 		case C.MotionNotify:
 			mevt := (*C.XMotionEvent)(unsafe.Pointer(xev))
+			w.clicks.move(image.Pt(int(mevt.x), int(mevt.y)))
+			// Deliver only the last of consecutive motion events.
+			if h.motionFollows(false, injected) {
+				break
+			}
 			w.w.Event(pointer.Event{
 				Type:    pointer.Move,
 				Source:  pointer.Mouse,
-				Buttons: w.pointerBtns,
+				Buttons: x11StateButtons(uint(mevt.state)),
 				Position: f32.Point{
 					X: float32(mevt.x),
 					Y: float32(mevt.y),
 				},
-				Time: time.Duration(mevt.time) * time.Millisecond,
+				Time:      time.Duration(mevt.time) * time.Millisecond,
+				Timestamp: w.clock.Time(uint32(mevt.time), time.Now()),
+				Modifiers: x11StateModifiers(uint(mevt.state)),
 			})
+		case C.EnterNotify, C.LeaveNotify:
+			cevt := (*C.XCrossingEvent)(unsafe.Pointer(xev))
+			// Skip the crossings caused by grabs and by
+			// the pointer moving to or from a child window.
+			if cevt.mode != C.NotifyNormal || cevt.detail == C.NotifyInferior {
+				break
+			}
+			ev := pointer.Event{
+				Type:    pointer.Enter,
+				Source:  pointer.Mouse,
+				Buttons: w.pointerBtns,
+				Position: f32.Point{
+					X: float32(cevt.x),
+					Y: float32(cevt.y),
+				},
+				Time:      time.Duration(cevt.time) * time.Millisecond,
+				Timestamp: w.clock.Time(uint32(cevt.time), time.Now()),
+			}
+			if _type == C.LeaveNotify {
+				ev.Type = pointer.Leave
+			} else {
+				// The valuators may have changed while the
+				// pointer was outside the window.
+				w.resetScrollValuators()
+			}
+			w.w.Event(ev)
 		case C.Expose: // update
+			eevt := (*C.XExposeEvent)(unsafe.Pointer(xev))
+			r := image.Rect(int(eevt.x), int(eevt.y), int(eevt.x+eevt.width), int(eevt.y+eevt.height))
+			w.damage = w.damage.Union(r)
 			// redraw only on the last expose event
-			redraw = (*C.XExposeEvent)(unsafe.Pointer(xev)).count == 0
+			if eevt.count == 0 {
+				redraw = true
+			}
+			// Exposed windows are at least partially visible.
+			w.visibility.obscured = false
+			w.updateStage()
 		case C.FocusIn:
+			w.mu.Lock()
+			w.focused = true
+			urgent := w.urgent
+			w.urgent = false
+			w.mu.Unlock()
+			if urgent {
+				// The user has noticed the window.
+				w.setUrgent(false)
+			}
 			w.w.Event(key.FocusEvent{Focus: true})
 		case C.FocusOut:
+			w.mu.Lock()
+			w.focused = false
+			w.mu.Unlock()
+			// Releases are not reported to unfocused windows.
+			w.keysDown = [256]bool{}
 			w.w.Event(key.FocusEvent{Focus: false})
 		case C.ConfigureNotify: // window configuration change
 			cevt := (*C.XConfigureEvent)(unsafe.Pointer(xev))
-			w.width = int(cevt.width)
-			w.height = int(cevt.height)
-			// redraw will be done by a later expose event
+			// Not every resize is followed by an expose event, for
+			// example when leaving fullscreen shrinks the window.
+			// Moves don't change the content and are ignored.
+			if width, height := int(cevt.width), int(cevt.height); width != w.width || height != w.height {
+				w.width, w.height = width, height
+				redraw = true
+			}
+			// The coordinates of synthetic events from the window
+			// manager are relative to the root window; others are
+			// relative to the parent, which may be a frame.
+			pos := image.Pt(int(cevt.x), int(cevt.y))
+			if cevt.send_event == 0 {
+				pos = w.rootPos()
+			}
+			// A change of monitor may not come with an expose
+			// event, so redraw if the scale changed.
+			if w.updateMonitor(pos.Add(image.Pt(w.width/2, w.height/2))) {
+				redraw = true
+			}
+			w.updateBounds(pos)
+		case C.PropertyNotify:
+			pevt := (*C.XPropertyEvent)(unsafe.Pointer(xev))
+			if pevt.window != w.xw {
+				if pevt.atom == w.atoms.resourceManager {
+					w.resourcesNotify()
+				}
+				break
+			}
+			switch pevt.atom {
+			case w.atoms.wmState:
+				w.updateWMState()
+			case w.atoms.frameExtents:
+				// The window manager sets the extents when
+				// the window is first mapped.
+				w.updateFrameExtents()
+			case w.atoms.icccmState:
+				state, ok := w.icccmState()
+				if !ok {
+					break
+				}
+				if s, ok := x11StageForState(state); ok {
+					w.visibility.iconic = s == system.StagePaused
+					// A restored window may not be exposed.
+					if w.updateStage() {
+						redraw = true
+					}
+				}
+			}
+		case C.ReparentNotify:
+			revt := (*C.XReparentEvent)(unsafe.Pointer(xev))
+			// The embedder reparents the window to the root
+			// window when it stops embedding it, or when
+			// it is destroyed.
+			if w.embedder != 0 && revt.parent == C.XDefaultRootWindow(w.x) {
+				w.embedder = 0
+			}
+		case C.MapNotify, C.UnmapNotify:
+			w.visibility.unmapped = _type == C.UnmapNotify
+			w.visibility.mapped = _type == C.MapNotify
+			if w.updateStage() {
+				redraw = true
+			}
+		case C.VisibilityNotify:
+			vevt := (*C.XVisibilityEvent)(unsafe.Pointer(xev))
+			w.visibility.obscured = vevt.state == C.VisibilityFullyObscured
+			if w.updateStage() {
+				redraw = true
+			}
+		case C.SelectionNotify:
+			cevt := (*C.XSelectionEvent)(unsafe.Pointer(xev))
+			if cevt.selection == w.atoms.xdnd.selection {
+				w.finishDrop(cevt)
+				break
+			}
+			if cevt.selection != w.atoms.clipboard && cevt.selection != C.XA_PRIMARY {
+				break
+			}
+			prop := w.atoms.clipboardContent
+			if cevt.selection == C.XA_PRIMARY {
+				prop = w.atoms.primaryContent
+			}
+			// Ignore replies to expired reads.
+			r := w.pendingSelectionRead(prop)
+			if r == nil {
+				break
+			}
+			mime := r.mime
+			if cevt.target == w.atoms.targets {
+				if w.convertSelection(cevt, mime) {
+					break
+				}
+				// Report an empty selection.
+				cevt.property = C.None
+			}
+			w.finishSelectionRead(prop)
+			var (
+				content []byte
+				ok      bool
+			)
+			// A None property means the conversion was refused or
+			// there is no owner.
+			if cevt.property != C.None {
+				content, ok = w.readProperty(cevt.property)
+			}
+			if ok && cevt.target == C.XA_STRING {
+				content = []byte(x11Latin1ToUTF8(content))
+			}
+			switch {
+			case cevt.selection == C.XA_PRIMARY:
+				w.w.Event(system.PrimarySelectionEvent{Text: string(content)})
+			case !ok:
+				w.w.Event(system.ClipboardEvent{})
+			case x11IsText(mime):
+				w.w.Event(system.ClipboardEvent{Text: string(content), MIME: x11TextMIME, Data: content})
+			default:
+				w.w.Event(system.ClipboardEvent{MIME: mime, Data: content})
+			}
+		case C.SelectionRequest:
+			cevt := (*C.XSelectionRequestEvent)(unsafe.Pointer(xev))
+			if cevt.selection != w.atoms.clipboard && cevt.selection != C.XA_PRIMARY {
+				break
+			}
+			w.serveSelection(cevt)
+		case C.SelectionClear:
+			cevt := (*C.XSelectionClearEvent)(unsafe.Pointer(xev))
+			if w.clearSelection(cevt) {
+				w.w.Event(system.ClipboardLostEvent{})
+			}
+		case C.GenericEvent:
+			h.handleXIEvent((*C.XGenericEventCookie)(unsafe.Pointer(xev)), injected)
 		case C.ClientMessage: // extensions
 			cevt := (*C.XClientMessageEvent)(unsafe.Pointer(xev))
+			if cevt.message_type == w.atoms.xembed {
+				w.handleXEmbed(cevt)
+				break
+			}
+			if w.handleXdnd(cevt) {
+				break
+			}
+			if cevt.message_type != w.atoms.wmProtocols {
+				if w.clientMessage != nil {
+					msg := x11ClientMessage(xev)
+					msg.Type = w.atomName(cevt.message_type)
+					w.clientMessage(msg)
+				}
+				break
+			}
 			switch *(*C.long)(unsafe.Pointer(&cevt.data)) {
+			case C.long(w.sync.request):
+				w.handleSyncRequest(cevt)
+			case C.long(w.atoms.wmPing):
+				// Reply from the event loop, so that a
+				// blocked loop is detected.
+				root := C.XDefaultRootWindow(w.x)
+				reply := x11PingReply(xev, root)
+				C.XSendEvent(w.x, root, C.False, C.SubstructureNotifyMask|C.SubstructureRedirectMask, &reply)
+				C.XFlush(w.x)
 			case C.long(w.evDelWindow):
+				ev := &system.CommandEvent{Type: system.CommandClose}
+				w.w.Event(ev)
+				if ev.Cancel {
+					break
+				}
 				w.dead = true
 				return false
 			}
 		}
 	}
-	return redraw
+	// Deliver the coalesced text before the frame.
+	w.flushEdit()
+	return redraw
+}
+
+// keyEvent delivers an event of a key press or release. Text is
+// coalesced into a single key.EditEvent if enabled, until an event
+// other than a key.Event of a character key.
+func (w *x11Window) keyEvent(e event.Event) {
+	if !w.coalesceEdits {
+		w.w.Event(e)
+		return
+	}
+	switch e := e.(type) {
+	case key.EditEvent:
+		w.edit += e.Text
+		return
+	case key.Event:
+		if x11IsCharacterKey(e) {
+			w.w.Event(e)
+			return
+		}
+	}
+	w.flushEdit()
+	w.w.Event(e)
+}
+
+// flushEdit delivers the text coalesced by keyEvent, if any.
+func (w *x11Window) flushEdit() {
+	if w.edit == "" {
+		return
+	}
+	e := key.EditEvent{Text: w.edit}
+	w.edit = ""
+	w.w.Event(e)
+}
+
+// x11IsCharacterKey reports whether e is the event of a key that
+// enters a character, with no modifiers other than shift.
+func x11IsCharacterKey(e key.Event) bool {
+	if e.Modifiers&^key.ModShift != 0 {
+		return false
+	}
+	if e.Name == key.NameSpace {
+		return true
+	}
+	return len(e.Name) == 1 && ' ' < e.Name[0] && e.Name[0] <= '~'
+}
+
+// x11FrameDelay returns the time left at now before the next
+// frame after the frame at last, for frames at least interval
+// apart.
+func x11FrameDelay(last, now time.Time, interval time.Duration) time.Duration {
+	if interval == 0 || last.IsZero() {
+		return 0
+	}
+	if d := last.Add(interval).Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// x11PollTimeout shortens the poll timeout in milliseconds, where
+// -1 means no timeout, to end at the wakeup time at. A zero at
+// leaves timeout unchanged.
+func x11PollTimeout(timeout int, at, now time.Time) int {
+	if at.IsZero() {
+		return timeout
+	}
+	d := at.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	// Round up to avoid waking up early.
+	ms := int((d + time.Millisecond - 1) / time.Millisecond)
+	if timeout == -1 || ms < timeout {
+		return ms
+	}
+	return timeout
+}
+
+// x11ClientMessage converts a ClientMessage event, except for
+// its type.
+func x11ClientMessage(xev *C.XEvent) ClientMessage {
+	cevt := (*C.XClientMessageEvent)(unsafe.Pointer(xev))
+	msg := ClientMessage{
+		Window: uintptr(cevt.window),
+		Format: int(cevt.format),
+		Bytes:  *(*[20]byte)(unsafe.Pointer(&cevt.data)),
+		Shorts: *(*[10]int16)(unsafe.Pointer(&cevt.data)),
+	}
+	for i, l := range *(*[5]C.long)(unsafe.Pointer(&cevt.data)) {
+		msg.Longs[i] = int64(l)
+	}
+	return msg
+}
+
+// x11PingReply returns the reply to the _NET_WM_PING message xev,
+// which is the message itself, addressed to the root window.
+func x11PingReply(xev *C.XEvent, root C.Window) C.XEvent {
+	reply := *xev
+	cevt := (*C.XClientMessageEvent)(unsafe.Pointer(&reply))
+	cevt.window = root
+	return reply
+}
+
+// atomName returns the name of an atom.
+func (w *x11Window) atomName(a C.Atom) string {
+	name := C.XGetAtomName(w.x, a)
+	if name == nil {
+		return ""
+	}
+	defer C.XFree(unsafe.Pointer(name))
+	return C.GoString(name)
+}
+
+// initSync creates the XSync counter of the _NET_WM_SYNC_REQUEST
+// protocol, which tells a compositing window manager when the window
+// has been redrawn after a resize. It returns false if the server
+// doesn't support the XSync extension.
+func (w *x11Window) initSync() bool {
+	var evBase, errBase, major, minor C.int
+	if C.XSyncQueryExtension(w.x, &evBase, &errBase) == 0 || C.XSyncInitialize(w.x, &major, &minor) == 0 {
+		return false
+	}
+	var zero C.XSyncValue
+	C.XSyncIntToValue(&zero, 0)
+	w.sync.counter = C.XSyncCreateCounter(w.x, zero)
+	counter := C.ulong(w.sync.counter)
+	C.XChangeProperty(w.x, w.xw, w.atom("_NET_WM_SYNC_REQUEST_COUNTER", false), C.XA_CARDINAL, 32,
+		C.PropModeReplace, (*C.uchar)(unsafe.Pointer(&counter)), 1)
+	return true
+}
+
+// handleSyncRequest records the counter value of a
+// _NET_WM_SYNC_REQUEST message, to be set after the next frame.
+func (w *x11Window) handleSyncRequest(cevt *C.XClientMessageEvent) {
+	if w.sync.counter == 0 {
+		return
+	}
+	data := (*[5]C.long)(unsafe.Pointer(&cevt.data))
+	C.XSyncIntsToValue(&w.sync.value, C.uint(data[2]), C.int(data[3]))
+	w.sync.pending = true
+}
+
+// frameDone tells the window manager that a frame requested by
+// _NET_WM_SYNC_REQUEST is drawn.
+func (w *x11Window) frameDone() {
+	if !w.sync.pending {
+		return
+	}
+	w.sync.pending = false
+	C.XSyncSetCounter(w.x, w.sync.counter, w.sync.value)
+	C.XFlush(w.x)
+}
+
+// x11EventMask returns the core event mask of a window that
+// receives the input categories of input.
+func x11EventMask(input InputMask) int64 {
+	mask := int64(C.ExposureMask | // update
+		C.StructureNotifyMask | // resize
+		C.PropertyChangeMask | // window manager state
+		C.VisibilityChangeMask) // obscured
+	if input&KeyboardInput != 0 {
+		mask |= C.KeyPressMask | C.KeyReleaseMask
+	}
+	if input&ButtonInput != 0 {
+		mask |= C.ButtonPressMask | C.ButtonReleaseMask
+	}
+	if input&MotionInput != 0 {
+		mask |= C.PointerMotionMask | // mouse movement
+			C.EnterWindowMask | C.LeaveWindowMask // mouse crossing
+	}
+	if input&FocusInput != 0 {
+		mask |= C.FocusChangeMask
+	}
+	return mask
+}
+
+// initXI2 enables smooth scrolling if the server supports XInput 2.1,
+// and touch input if it supports XInput 2.2. The wheel buttons are used
+// for scrolling otherwise, and touches arrive as emulated mouse events.
+func (w *x11Window) initXI2() {
+	name := C.CString("XInputExtension")
+	defer C.free(unsafe.Pointer(name))
+	var opcode, evBase, errBase C.int
+	if C.XQueryExtension(w.x, name, &opcode, &evBase, &errBase) != C.True {
+		return
+	}
+	// Ask for 2.2 for touch events; the server replies with the
+	// version it supports.
+	major, minor := C.int(2), C.int(2)
+	if C.XIQueryVersion(w.x, &major, &minor) != C.Success || major < 2 || major == 2 && minor < 1 {
+		return
+	}
+	events := []int{C.XI_Motion, C.XI_DeviceChanged}
+	touch := major > 2 || minor >= 2
+	if touch {
+		events = append(events, C.XI_TouchBegin, C.XI_TouchUpdate, C.XI_TouchEnd)
+	}
+	w.selectXIEvents(w.xw, events)
+	// Raw events are only delivered to the root window. Their flags
+	// tell the emulated wheel buttons from the real ones, which
+	// the core button events don't.
+	w.selectXIEvents(C.XDefaultRootWindow(w.x), []int{C.XI_RawButtonPress, C.XI_RawButtonRelease})
+	w.xi2.opcode = opcode
+	w.xi2.valuators = make(map[C.int][]x11ScrollValuator)
+	if touch {
+		w.xi2.touches = make(x11Touches)
+	}
+	w.updateScrollValuators(C.XIAllDevices)
+}
+
+// selectXIEvents selects the XInput 2 events of the master devices
+// for a window.
+func (w *x11Window) selectXIEvents(win C.Window, events []int) {
+	// The mask is passed in C memory because XIEventMask
+	// points to it.
+	const maskLen = (C.XI_LASTEVENT + 7) / 8
+	mask := (*[maskLen]C.uchar)(C.calloc(maskLen, 1))
+	defer C.free(unsafe.Pointer(mask))
+	for _, ev := range events {
+		mask[ev>>3] |= 1 << uint(ev&7)
+	}
+	evmask := C.XIEventMask{
+		deviceid: C.XIAllMasterDevices,
+		mask_len: maskLen,
+		mask:     &mask[0],
+	}
+	C.XISelectEvents(w.x, win, &evmask, 1)
+}
+
+// updateScrollValuators queries the scroll valuators of a device, or
+// of every device if dev is XIAllDevices.
+func (w *x11Window) updateScrollValuators(dev C.int) {
+	var n C.int
+	info := C.XIQueryDevice(w.x, dev, &n)
+	if info == nil {
+		return
+	}
+	defer C.XIFreeDeviceInfo(info)
+	var devs []C.XIDeviceInfo
+	x11Slice(&devs, unsafe.Pointer(info), int(n))
+	for _, d := range devs {
+		var classes []*C.XIAnyClassInfo
+		x11Slice(&classes, unsafe.Pointer(d.classes), int(d.num_classes))
+		var vals []x11ScrollValuator
+		for _, c := range classes {
+			if c._type != C.XIScrollClass {
+				continue
+			}
+			sc := (*C.XIScrollClassInfo)(unsafe.Pointer(c))
+			if sc.increment == 0 {
+				continue
+			}
+			vals = append(vals, x11ScrollValuator{
+				number:     int(sc.number),
+				horizontal: sc.scroll_type == C.XIScrollTypeHorizontal,
+				increment:  float64(sc.increment),
+			})
+		}
+		// Start from the current values so the first
+		// scroll event isn't lost.
+		for _, c := range classes {
+			if c._type != C.XIValuatorClass {
+				continue
+			}
+			vc := (*C.XIValuatorClassInfo)(unsafe.Pointer(c))
+			for i := range vals {
+				if vals[i].number == int(vc.number) {
+					vals[i].value = float64(vc.value)
+					vals[i].valid = true
+				}
+			}
+		}
+		if len(vals) > 0 {
+			w.xi2.valuators[d.deviceid] = vals
+		} else {
+			delete(w.xi2.valuators, d.deviceid)
+		}
+	}
+}
+
+// x11Touches maps the touch ids of XInput, which grow without bound,
+// to small pointer IDs. The IDs are reused once their touch ends.
+type x11Touches map[uint32]pointer.ID
+
+// begin assigns the lowest unused pointer ID to a new touch.
+func (t x11Touches) begin(touch uint32) pointer.ID {
+	var id pointer.ID
+	for {
+		used := false
+		for _, other := range t {
+			if other == id {
+				used = true
+				break
+			}
+		}
+		if !used {
+			break
+		}
+		id++
+	}
+	t[touch] = id
+	return id
+}
+
+// end removes a touch and returns its pointer ID.
+func (t x11Touches) end(touch uint32) (pointer.ID, bool) {
+	id, ok := t[touch]
+	delete(t, touch)
+	return id, ok
+}
+
+// resetScrollValuators forgets the last valuator values.
+func (w *x11Window) resetScrollValuators() {
+	for _, vals := range w.xi2.valuators {
+		for i := range vals {
+			vals[i].valid = false
+		}
+	}
+}
+
+// handleXIEvent handles the XInput 2 events. Selecting XI_Motion
+// replaces the core MotionNotify events. The data of injected events
+// is already present, in memory allocated by C.calloc.
+func (h *x11EventHandler) handleXIEvent(cookie *C.XGenericEventCookie, injected bool) {
+	w := h.w
+	if injected {
+		defer C.free(cookie.data)
+	}
+	if w.xi2.opcode == 0 || cookie.extension != w.xi2.opcode {
+		return
+	}
+	if !injected {
+		if C.XGetEventData(w.x, cookie) == 0 {
+			return
+		}
+		defer C.XFreeEventData(w.x, cookie)
+	}
+	switch cookie.evtype {
+	case C.XI_Motion:
+		dev := (*C.XIDeviceEvent)(cookie.data)
+		if dev.flags&C.XIPointerEmulated != 0 {
+			// Touches are reported by the touch events.
+			break
+		}
+		pos := f32.Point{X: float32(dev.event_x), Y: float32(dev.event_y)}
+		w.clicks.move(image.Pt(int(pos.X), int(pos.Y)))
+		// Deliver only the last of consecutive motion events,
+		// with the scrolling of the events before it.
+		scroll := w.xi2.scroll.Add(w.scrollDelta(dev))
+		if h.motionFollows(true, injected) {
+			w.xi2.scroll = scroll
+			break
+		}
+		w.xi2.scroll = f32.Point{}
+		w.w.Event(pointer.Event{
+			Type:      pointer.Move,
+			Source:    pointer.Mouse,
+			Buttons:   x11StateButtons(x11XIButtonState(dev.buttons)),
+			Position:  pos,
+			Scroll:    scroll,
+			Time:      time.Duration(dev.time) * time.Millisecond,
+			Timestamp: w.clock.Time(uint32(dev.time), time.Now()),
+			Modifiers: x11StateModifiers(uint(dev.mods.effective)),
+		})
+	case C.XI_DeviceChanged:
+		dc := (*C.XIDeviceChangedEvent)(cookie.data)
+		if dc.reason == C.XIDeviceChange {
+			w.updateScrollValuators(dc.sourceid)
+		}
+	case C.XI_TouchBegin, C.XI_TouchUpdate, C.XI_TouchEnd:
+		w.handleTouch(cookie.evtype, (*C.XIDeviceEvent)(cookie.data))
+	case C.XI_RawButtonPress, C.XI_RawButtonRelease:
+		raw := (*C.XIRawEvent)(cookie.data)
+		if raw.detail >= C.Button4 && raw.detail <= 7 {
+			w.xi2.emulatedWheel = raw.flags&C.XIPointerEmulated != 0
+		}
+	}
+}
+
+// x11Clock converts the X server time of events, in milliseconds
+// since an unspecified time, to the time of the program.
+type x11Clock struct {
+	// base is the time of server time zero.
+	base time.Time
+	// last is the last server time, for detecting the
+	// wrap-around of the server time.
+	last uint32
+	// wraps is the duration of the wrap-arounds.
+	wraps time.Duration
+}
+
+// Time returns the time of the server time t, for an event that
+// arrived at now. The clocks are synchronized at the first event, and
+// whenever an event would have happened after it arrived, because the
+// delivery of earlier events was delayed.
+func (c *x11Clock) Time(t uint32, now time.Time) time.Time {
+	if !c.base.IsZero() && t < c.last && c.last-t > 1<<31 {
+		// The server time wraps around after about 49.7 days.
+		c.wraps += 1 << 32 * time.Millisecond
+	}
+	c.last = t
+	d := c.wraps + time.Duration(t)*time.Millisecond
+	if ts := c.base.Add(d); !c.base.IsZero() && !ts.After(now) {
+		return ts
+	}
+	c.base = now.Add(-d)
+	return now
+}
+
+// handleTouch converts a touch event to a pointer event. The detail
+// of the event is the touch id.
+func (w *x11Window) handleTouch(evtype C.int, dev *C.XIDeviceEvent) {
+	if w.xi2.touches == nil {
+		return
+	}
+	touch := uint32(dev.detail)
+	ev := pointer.Event{
+		Source:    pointer.Touch,
+		Position:  f32.Point{X: float32(dev.event_x), Y: float32(dev.event_y)},
+		Time:      time.Duration(dev.time) * time.Millisecond,
+		Timestamp: w.clock.Time(uint32(dev.time), time.Now()),
+	}
+	switch evtype {
+	case C.XI_TouchBegin:
+		ev.Type = pointer.Press
+		ev.PointerID = w.xi2.touches.begin(touch)
+	case C.XI_TouchUpdate:
+		id, ok := w.xi2.touches[touch]
+		if !ok {
+			return
+		}
+		ev.Type = pointer.Move
+		ev.PointerID = id
+	case C.XI_TouchEnd:
+		id, ok := w.xi2.touches.end(touch)
+		if !ok {
+			return
+		}
+		ev.Type = pointer.Release
+		ev.PointerID = id
+	}
+	w.w.Event(ev)
+}
+
+// x11Slice sets the slice pointed to by s to the n elements of the
+// C array at p.
+func x11Slice(s interface{}, p unsafe.Pointer, n int) {
+	h := (*reflect.SliceHeader)(unsafe.Pointer(reflect.ValueOf(s).Pointer()))
+	h.Data = uintptr(p)
+	h.Len = n
+	h.Cap = n
+}
+
+// x11XIButtonState converts the button state of an XInput event
+// to the button mask bits of a core event state.
+func x11XIButtonState(st C.XIButtonState) uint {
+	n := int(st.mask_len)
+	if n == 0 {
+		return 0
+	}
+	var mask []C.uchar
+	x11Slice(&mask, unsafe.Pointer(st.mask), n)
+	var state uint
+	// The mask has a bit for every button number.
+	for b := 1; b <= 3 && b>>3 < n; b++ {
+		if mask[b>>3]&(1<<uint(b&7)) != 0 {
+			state |= C.Button1Mask << uint(b-1)
+		}
+	}
+	return state
+}
+
+// scrollDelta computes the scroll distance from the changes of
+// the scroll valuators in a motion event.
+func (w *x11Window) scrollDelta(dev *C.XIDeviceEvent) f32.Point {
+	var scroll f32.Point
+	vals := w.xi2.valuators[dev.sourceid]
+	if len(vals) == 0 {
+		return scroll
+	}
+	n := int(dev.valuators.mask_len)
+	var mask []C.uchar
+	x11Slice(&mask, unsafe.Pointer(dev.valuators.mask), n)
+	// The values are packed for the valuators set in the mask.
+	nvals := 0
+	for _, m := range mask {
+		nvals += bits.OnesCount8(uint8(m))
+	}
+	var values []C.double
+	x11Slice(&values, unsafe.Pointer(dev.valuators.values), nvals)
+	k := 0
+	for i := 0; i < n*8; i++ {
+		if mask[i>>3]&(1<<uint(i&7)) == 0 {
+			continue
+		}
+		v := float64(values[k])
+		k++
+		for j := range vals {
+			s := &vals[j]
+			if s.number != i {
+				continue
+			}
+			if s.valid {
+				d := float32((v - s.value) / s.increment * float64(w.cfg.scrollScale))
+				if s.horizontal {
+					scroll.X += d
+				} else {
+					scroll.Y += d
+				}
+			}
+			s.value, s.valid = v, true
+		}
+	}
+	return scroll
+}
+
+// readProperty reads and deletes a property of the window, typically
+// the destination of a selection conversion. It reports false if the
+// property is missing or uses the unsupported INCR protocol.
+func (w *x11Window) readProperty(prop C.Atom) ([]byte, bool) {
+	var (
+		typ        C.Atom
+		format     C.int
+		nitems     C.ulong
+		bytesAfter C.ulong
+		data       *C.uchar
+	)
+	// The length argument is in 32-bit units; ask for everything.
+	const maxLen = 0x7fffffff
+	if C.XGetWindowProperty(w.x, w.xw, prop, 0, maxLen, C.True, C.AnyPropertyType,
+		&typ, &format, &nitems, &bytesAfter, &data) != C.Success {
+		return nil, false
+	}
+	if data == nil {
+		return nil, false
+	}
+	defer C.XFree(unsafe.Pointer(data))
+	if typ == w.atoms.incr || format != 8 {
+		return nil, false
+	}
+	return C.GoBytes(unsafe.Pointer(data), C.int(nitems)), true
+}
+
+// maxPropertySize returns the maximum number of bytes that fit in a
+// single XChangeProperty request.
+func (w *x11Window) maxPropertySize() int {
+	max := C.XExtendedMaxRequestSize(w.x)
+	if max == 0 {
+		max = C.XMaxRequestSize(w.x)
+	}
+	// The size is in 4-byte units and includes the 24 byte
+	// request header.
+	return int(max)*4 - 24
+}
+
+// serveSelection answers a SelectionRequest for a selection owned by
+// the window.
+func (w *x11Window) serveSelection(req *C.XSelectionRequestEvent) {
+	prop := req.property
+	if prop == C.None {
+		// Obsolete requestors use the target as property.
+		prop = req.target
+	}
+	w.mu.Lock()
+	sel := w.clipboard
+	if req.selection == C.XA_PRIMARY {
+		sel = w.primary
+	}
+	w.mu.Unlock()
+	// Xlib expects format 32 properties as arrays of longs.
+	targets := []C.ulong{C.ulong(w.atoms.targets)}
+	served := false
+	for _, name := range x11MIMETargets(sel.mime) {
+		t := w.atom(name, false)
+		targets = append(targets, C.ulong(t))
+		served = served || t == req.target
+	}
+	switch {
+	case req.target == w.atoms.targets:
+		C.XChangeProperty(w.x, req.requestor, prop, C.XA_ATOM, 32,
+			C.PropModeReplace, (*C.uchar)(unsafe.Pointer(&targets[0])), C.int(len(targets)))
+	case served:
+		content := sel.data
+		if len(content) > w.maxPropertySize() {
+			// Refuse content that needs INCR transfers.
+			prop = C.None
+			break
+		}
+		var ptr *C.uchar
+		if len(content) > 0 {
+			ptr = (*C.uchar)(unsafe.Pointer(&content[0]))
+		}
+		C.XChangeProperty(w.x, req.requestor, prop, req.target, 8,
+			C.PropModeReplace, ptr, C.int(len(content)))
+	default:
+		prop = C.None
+	}
+	w.notifySelection(req, prop)
+}
+
+// notifySelection sends the answer to a SelectionRequest. A None
+// property refuses the request.
+func (w *x11Window) notifySelection(req *C.XSelectionRequestEvent, prop C.Atom) {
+	var xev C.XEvent
+	notify := (*C.XSelectionEvent)(unsafe.Pointer(&xev))
+	*notify = C.XSelectionEvent{
+		_type:     C.SelectionNotify,
+		display:   w.x,
+		requestor: req.requestor,
+		selection: req.selection,
+		target:    req.target,
+		property:  prop,
+		time:      req.time,
+	}
+	C.XSendEvent(w.x, req.requestor, C.False, 0, &xev)
+}
+
+// abortSelectionRequests refuses the SelectionRequests that reached
+// the window but were not served, so that their requestors don't
+// wait for a window that is going away.
+func (w *x11Window) abortSelectionRequests() {
+	// Collect the requests in flight.
+	C.XSync(w.x, C.False)
+	var xev C.XEvent
+	for C.XCheckTypedWindowEvent(w.x, w.xw, C.SelectionRequest, &xev) != 0 {
+		req := (*C.XSelectionRequestEvent)(unsafe.Pointer(&xev))
+		w.notifySelection(req, C.None)
+	}
+	C.XFlush(w.x)
 }
 
 var (
+	// x11ErrorMu serializes the use of the process wide
+	// error handler.
+	x11ErrorMu sync.Mutex
 	x11Threads sync.Once
+
+	// x11Windows maps connections to their windows, for
+	// the error handlers of Xlib.
+	x11WindowsMu sync.Mutex
+	x11Windows   = make(map[*C.Display]*x11Window)
 )
 
+// x11Error is a protocol error reported by the X server.
+type x11Error struct {
+	Code     int
+	Request  int
+	Minor    int
+	Resource uint64
+	// Text is the description of Code.
+	Text string
+}
+
+func (e x11Error) Error() string {
+	return fmt.Sprintf("x11: %s (error %d) in request %d.%d on resource %#x", e.Text, e.Code, e.Request, e.Minor, e.Resource)
+}
+
+// x11Init initializes Xlib once per process. It replaces the default
+// error handlers of Xlib, which exit the process.
+func x11Init() error {
+	var err error
+	x11Threads.Do(func() {
+		if C.XInitThreads() == 0 {
+			err = errors.New("x11: threads init failed")
+		}
+		C.XrmInitialize()
+		C.gio_x11_set_error_handlers()
+	})
+	return err
+}
+
+//export gio_x11_onError
+func gio_x11_onError(dpy *C.Display, e *C.XErrorEvent) {
+	var buf [256]C.char
+	C.XGetErrorText(dpy, C.int(e.error_code), &buf[0], C.int(len(buf)))
+	log.Print(x11Error{
+		Code:     int(e.error_code),
+		Request:  int(e.request_code),
+		Minor:    int(e.minor_code),
+		Resource: uint64(e.resourceid),
+		Text:     C.GoString(&buf[0]),
+	})
+}
+
+//export gio_x11_onIOError
+func gio_x11_onIOError(dpy *C.Display) {
+	x11WindowsMu.Lock()
+	w := x11Windows[dpy]
+	x11WindowsMu.Unlock()
+	if w == nil {
+		log.Print("x11: lost connection to the X server")
+		return
+	}
+	w.ioErr.mu.Lock()
+	if w.ioErr.err == nil {
+		w.ioErr.err = errors.New("x11: lost connection to the X server")
+	}
+	w.ioErr.mu.Unlock()
+	w.wakeup()
+}
+
+// ioError returns the error recorded by the I/O error handler.
+func (w *x11Window) ioError() error {
+	w.ioErr.mu.Lock()
+	defer w.ioErr.mu.Unlock()
+	return w.ioErr.err
+}
+
 func init() {
 	x11Driver = newX11Window
 }
 
 func newX11Window(gioWin Callbacks, opts *Options) error {
-	var err error
-
 	pipe := make([]int, 2)
 	if err := syscall.Pipe2(pipe, syscall.O_NONBLOCK|syscall.O_CLOEXEC); err != nil {
 		return fmt.Errorf("NewX11Window: failed to create pipe: %w", err)
 	}
 
-	x11Threads.Do(func() {
-		if C.XInitThreads() == 0 {
-			err = errors.New("x11: threads init failed")
-		}
-		C.XrmInitialize()
-	})
-	if err != nil {
+	if err := x11Init(); err != nil {
+		syscall.Close(pipe[0])
+		syscall.Close(pipe[1])
 		return err
 	}
-	dpy := C.XOpenDisplay(nil)
-	if dpy == nil {
-		return errors.New("x11: cannot connect to the X server")
+	name := opts.Display
+	if name == "" {
+		name = os.Getenv("DISPLAY")
+	}
+	dpy, err := x11OpenDisplay(name, opts.Screen)
+	if err != nil {
+		syscall.Close(pipe[0])
+		syscall.Close(pipe[1])
+		return err
 	}
 	var major, minor C.int = C.XkbMajorVersion, C.XkbMinorVersion
 	var xkbEventBase C.int
 	if C.XkbQueryExtension(dpy, nil, &xkbEventBase, nil, &major, &minor) != C.True {
 		C.XCloseDisplay(dpy)
+		syscall.Close(pipe[0])
+		syscall.Close(pipe[1])
 		return errors.New("x11: XkbQueryExtension failed")
 	}
 	const bits = C.uint(C.XkbNewKeyboardNotifyMask | C.XkbMapNotifyMask | C.XkbStateNotifyMask)
 	if C.XkbSelectEvents(dpy, C.XkbUseCoreKbd, bits, bits) != C.True {
 		C.XCloseDisplay(dpy)
+		syscall.Close(pipe[0])
+		syscall.Close(pipe[1])
 		return errors.New("x11: XkbSelectEvents failed")
 	}
+	// Without detectable auto-repeat, the server sends a release and a
+	// press for every repeat, and repeats are recognized by their equal
+	// timestamps instead.
+	var detectableRepeat C.Bool
+	C.XkbSetDetectableAutoRepeat(dpy, C.True, &detectableRepeat)
 	xkb, err := xkb.New()
 	if err != nil {
 		C.XCloseDisplay(dpy)
+		syscall.Close(pipe[0])
+		syscall.Close(pipe[1])
 		return fmt.Errorf("x11: %v", err)
 	}
 
-	ppsp := x11DetectUIScale(dpy)
-	cfg := config{pxPerDp: ppsp, pxPerSp: ppsp}
+	var randrEventBase, randrErrorBase C.int
+	randr := C.XRRQueryExtension(dpy, &randrEventBase, &randrErrorBase) == C.True
+	pos := opts.Pos
+	if opts.Centered {
+		if pos != (image.Point{}) {
+			log.Println("x11: both Pos and Centered are set; centering the window")
+		}
+		// Center on the monitor with the pointer.
+		var root, child C.Window
+		var rootX, rootY, winX, winY C.int
+		var mask C.uint
+		C.XQueryPointer(dpy, C.XDefaultRootWindow(dpy), &root, &child, &rootX, &rootY, &winX, &winY, &mask)
+		pos = image.Pt(int(rootX), int(rootY))
+	}
+	var mons []x11Monitor
+	var mon x11Monitor
+	if randr {
+		mons = x11Monitors(dpy)
+		mon, _ = x11MonitorAt(mons, pos)
+	}
+	resources := x11ResourceString(dpy)
+	// Load cursors from the user's theme. Xcursor otherwise
+	// falls back to the environment and its defaults.
+	if theme, size := x11CursorTheme(resources); theme != "" || size > 0 {
+		if theme != "" {
+			ctheme := C.CString(theme)
+			C.XcursorSetTheme(dpy, ctheme)
+			C.free(unsafe.Pointer(ctheme))
+		}
+		if size > 0 {
+			C.XcursorSetDefaultSize(dpy, C.int(size))
+		}
+	}
+	ppdp := x11MonitorScale(mon, resources)
+	ppsp := ppdp * x11FontScale(opts.FontScale, resources)
+	cfg := config{pxPerDp: ppdp, pxPerSp: ppsp, scrollScale: opts.ScrollScale, refreshRate: mon.refreshRate}
+	if cfg.refreshRate == 0 {
+		cfg.refreshRate = x11DefaultRefreshRate
+	}
+	if cfg.scrollScale == 0 {
+		cfg.scrollScale = x11DetectScrollScale(dpy)
+	}
+	width, height := cfg.Px(opts.Width), cfg.Px(opts.Height)
+	if opts.Centered {
+		screen := mon.bounds
+		if screen.Empty() {
+			scr := C.XDefaultScreen(dpy)
+			screen = image.Rect(0, 0, int(C.XDisplayWidth(dpy, scr)), int(C.XDisplayHeight(dpy, scr)))
+		}
+		pos = screen.Min.Add(screen.Size().Sub(image.Pt(width, height)).Div(2))
+	}
 	swa := C.XSetWindowAttributes{
-		event_mask: C.ExposureMask | C.FocusChangeMask | // update
-			C.KeyPressMask | C.KeyReleaseMask | // keyboard
-			C.ButtonPressMask | C.ButtonReleaseMask | // mouse clicks
-			C.PointerMotionMask | // mouse movement
-			C.StructureNotifyMask, // resize
+		event_mask:        C.long(x11EventMask(AllInput &^ opts.DisabledInput)),
 		background_pixmap: C.None,
 		override_redirect: C.False,
 	}
+	mask := C.ulong(C.CWEventMask | C.CWBackPixmap | C.CWOverrideRedirect)
+	// The window has the visual of the root window.
+	vis := C.XDefaultVisual(dpy, C.XDefaultScreen(dpy))
+	if opts.BackgroundColor.A != 0 && vis.class == C.TrueColor {
+		swa.background_pixel = C.ulong(x11ColorPixel(opts.BackgroundColor,
+			uint64(vis.red_mask), uint64(vis.green_mask), uint64(vis.blue_mask)))
+		// The pixel takes precedence over the pixmap.
+		mask |= C.CWBackPixel
+	}
 	win := C.XCreateWindow(dpy, C.XDefaultRootWindow(dpy),
-		0, 0, C.uint(cfg.Px(opts.Width)), C.uint(cfg.Px(opts.Height)),
+		C.int(pos.X), C.int(pos.Y), C.uint(width), C.uint(height),
 		0, C.CopyFromParent, C.InputOutput, nil,
-		C.CWEventMask|C.CWBackPixmap|C.CWOverrideRedirect, &swa)
+		mask, &swa)
 
 	w := &x11Window{
 		w: gioWin, x: dpy, xw: win,
-		width:        cfg.Px(opts.Width),
-		height:       cfg.Px(opts.Height),
-		cfg:          cfg,
-		xkb:          xkb,
-		xkbEventBase: xkbEventBase,
+		width:            width,
+		height:           height,
+		cfg:              cfg,
+		xkb:              xkb,
+		xkbEventBase:     xkbEventBase,
+		randr:            randr,
+		randrEventBase:   randrEventBase,
+		monitors:         mons,
+		monitorsValid:    randr,
+		resources:        resources,
+		fontScale:        opts.FontScale,
+		clientMessage:    opts.ClientMessage,
+		coalesceEdits:    opts.CoalesceEdits,
+		detectableRepeat: detectableRepeat == C.True,
+		monitor:          mon,
+	}
+	if opts.MaxFPS > 0 {
+		w.frameInterval = time.Second / time.Duration(opts.MaxFPS)
 	}
 	w.notify.read = pipe[0]
 	w.notify.write = pipe[1]
+	if opts.Wakeup != nil {
+		w.stop = make(chan struct{})
+		go w.forwardWakeups(opts.Wakeup, w.stop)
+	}
 
 	if err := w.updateXkbKeymap(); err != nil {
 		w.destroy()
 		return err
 	}
 
+	// XInput 2 replaces the core motion events and delivers
+	// touches and smooth scrolling as motion.
+	if input := AllInput &^ opts.DisabledInput; input&ButtonInput != 0 && input&MotionInput != 0 {
+		w.initXI2()
+	}
+
 	var hints C.XWMHints
 	hints.input = C.True
 	hints.flags = C.InputHint
 	C.XSetWMHints(dpy, win, &hints)
 
+	w.setClassHint(opts.Class)
+	w.setRole(opts.Role)
+	w.setProcessHints()
+	if opts.TransientFor != 0 {
+		w.setTransientFor(opts.TransientFor)
+	}
+	if opts.Type != "" {
+		w.setType(opts.Type)
+	}
+
+	w.clicks.interval = opts.ClickInterval
+	if w.clicks.interval == 0 {
+		w.clicks.interval = x11ClickInterval
+	}
+
+	w.sizeHints.minWidth, w.sizeHints.minHeight = opts.MinWidth, opts.MinHeight
+	w.sizeHints.maxWidth, w.sizeHints.maxHeight = opts.MaxWidth, opts.MaxHeight
+	w.sizeHints.pos = pos
+	w.sizeHints.fixed = !opts.Resizable
+	w.sizeHints.width, w.sizeHints.height = opts.Width, opts.Height
+	w.sizeHints.hasPos = opts.Centered || pos != (image.Point{})
+	w.updateSizeHints()
+
+	w.atoms.utf8string = w.atom("UTF8_STRING", false)
+	w.atoms.wmName = w.atom("_NET_WM_NAME", false)
+	w.atoms.clipboard = w.atom("CLIPBOARD", false)
+	w.atoms.clipboardContent = w.atom("CLIPBOARD_CONTENT", false)
+	w.atoms.primaryContent = w.atom("PRIMARY_CONTENT", false)
+	w.atoms.targets = w.atom("TARGETS", false)
+	w.atoms.textPlain = w.atom("text/plain", false)
+	w.atoms.incr = w.atom("INCR", false)
+	w.atoms.wmIcon = w.atom("_NET_WM_ICON", false)
+	w.atoms.wmOpacity = w.atom("_NET_WM_WINDOW_OPACITY", false)
+	w.atoms.wmState = w.atom("_NET_WM_STATE", false)
+	w.atoms.wmStateFullscreen = w.atom("_NET_WM_STATE_FULLSCREEN", false)
+	w.atoms.wmStateMaxHorz = w.atom("_NET_WM_STATE_MAXIMIZED_HORZ", false)
+	w.atoms.wmStateMaxVert = w.atom("_NET_WM_STATE_MAXIMIZED_VERT", false)
+	w.atoms.wmStateAbove = w.atom("_NET_WM_STATE_ABOVE", false)
+	w.atoms.wmStateDemandsAttention = w.atom("_NET_WM_STATE_DEMANDS_ATTENTION", false)
+	w.atoms.motifHints = w.atom("_MOTIF_WM_HINTS", false)
+	w.atoms.frameExtents = w.atom("_NET_FRAME_EXTENTS", false)
+	w.atoms.wmMoveResize = w.atom("_NET_WM_MOVERESIZE", false)
+	w.atoms.wmProtocols = w.atom("WM_PROTOCOLS", false)
+	w.atoms.icccmState = w.atom("WM_STATE", false)
+	w.atoms.resourceManager = w.atom("RESOURCE_MANAGER", false)
+	w.atoms.cmSelection = w.atom(fmt.Sprintf("_NET_WM_CM_S%d", int(C.XDefaultScreen(dpy))), false)
+	w.atoms.manager = w.atom("MANAGER", false)
+	// Watch the resource database for changes of the UI scale, and
+	// the default root window for new compositing managers.
+	resourceRoot, root := C.XRootWindow(dpy, 0), C.XDefaultRootWindow(dpy)
+	if resourceRoot == root {
+		C.XSelectInput(dpy, root, C.PropertyChangeMask|C.StructureNotifyMask)
+	} else {
+		C.XSelectInput(dpy, resourceRoot, C.PropertyChangeMask)
+		C.XSelectInput(dpy, root, C.StructureNotifyMask)
+	}
+	w.updateCompositor()
+	if randr {
+		// Watch the monitors for changes of the UI scale.
+		C.XRRSelectInput(dpy, root, C.RRScreenChangeNotifyMask|C.RRCrtcChangeNotifyMask)
+	}
+
+	// The initial state of an unmapped window is set
+	// directly on the window.
+	var state []C.Atom
+	if opts.Fullscreen {
+		w.fullscreen = true
+		state = append(state, w.atoms.wmStateFullscreen)
+	}
+	if opts.Maximized {
+		w.maximized = true
+		state = append(state, w.atoms.wmStateMaxHorz, w.atoms.wmStateMaxVert)
+	}
+	if opts.AlwaysOnTop {
+		w.above = true
+		state = append(state, w.atoms.wmStateAbove)
+	}
+	if !opts.Decorated {
+		w.setDecorated(false)
+	}
+	if len(state) > 0 {
+		// Xlib expects format 32 properties as arrays of longs.
+		longs := make([]C.ulong, len(state))
+		for i, a := range state {
+			longs[i] = C.ulong(a)
+		}
+		C.XChangeProperty(dpy, win, w.atoms.wmState, C.XA_ATOM, 32, C.PropModeReplace,
+			(*C.uchar)(unsafe.Pointer(&longs[0])), C.int(len(longs)))
+	}
+
+	if len(opts.Icon) > 0 {
+		w.setIcon(opts.Icon)
+	}
+	if opts.Opacity < 1 {
+		w.setOpacity(opts.Opacity)
+	}
+
 	// set the name
-	ctitle := C.CString(opts.Title)
-	defer C.free(unsafe.Pointer(ctitle))
-	C.XStoreName(dpy, win, ctitle)
-	// set _NET_WM_NAME as well for UTF-8 support in window title.
-	C.XSetTextProperty(dpy, win,
-		&C.XTextProperty{
-			value:    (*C.uchar)(unsafe.Pointer(ctitle)),
-			encoding: w.atom("UTF8_STRING", false),
-			format:   8,
-			nitems:   C.ulong(len(opts.Title)),
-		},
-		w.atom("_NET_WM_NAME", false))
+	w.setTitle(opts.Title)
 
 	// extensions
 	w.evDelWindow = w.atom("WM_DELETE_WINDOW", false)
-	C.XSetWMProtocols(dpy, win, &w.evDelWindow, 1)
+	w.atoms.wmPing = w.atom("_NET_WM_PING", false)
+	protocols := []C.Atom{w.evDelWindow, w.atoms.wmPing}
+	if w.initSync() {
+		w.sync.request = w.atom("_NET_WM_SYNC_REQUEST", false)
+		protocols = append(protocols, w.sync.request)
+	}
+	C.XSetWMProtocols(dpy, win, &protocols[0], C.int(len(protocols)))
+
+	w.atoms.xembed = w.atom("_XEMBED", false)
+	w.atoms.xembedInfo = w.atom("_XEMBED_INFO", false)
+	w.atoms.xdnd.aware = w.atom("XdndAware", false)
+	w.atoms.xdnd.enter = w.atom("XdndEnter", false)
+	w.atoms.xdnd.position = w.atom("XdndPosition", false)
+	w.atoms.xdnd.status = w.atom("XdndStatus", false)
+	w.atoms.xdnd.leave = w.atom("XdndLeave", false)
+	w.atoms.xdnd.drop = w.atom("XdndDrop", false)
+	w.atoms.xdnd.finished = w.atom("XdndFinished", false)
+	w.atoms.xdnd.selection = w.atom("XdndSelection", false)
+	w.atoms.xdnd.typeList = w.atom("XdndTypeList", false)
+	w.atoms.xdnd.actionCopy = w.atom("XdndActionCopy", false)
+	w.atoms.xdnd.uriList = w.atom("text/uri-list", false)
+	w.atoms.xdnd.content = w.atom("XDND_CONTENT", false)
+	if !opts.Focused {
+		// A zero user time asks the window manager not
+		// to focus the new window.
+		var userTime C.ulong
+		C.XChangeProperty(dpy, win, w.atom("_NET_WM_USER_TIME", false), C.XA_CARDINAL, 32, C.PropModeReplace,
+			(*C.uchar)(unsafe.Pointer(&userTime)), 1)
+	}
+
+	version := C.ulong(xdndVersion)
+	C.XChangeProperty(dpy, win, w.atoms.xdnd.aware, C.XA_ATOM, 32, C.PropModeReplace,
+		(*C.uchar)(unsafe.Pointer(&version)), 1)
 
 	// make the window visible on the screen
-	C.XMapWindow(dpy, win)
+	switch {
+	case opts.Embed != 0:
+		w.embed(C.Window(opts.Embed))
+	case !opts.Headless:
+		// Ask for the frame extents before the window is
+		// mapped. They arrive as a PropertyNotify event.
+		root := C.XDefaultRootWindow(dpy)
+		w.sendClientMessage(root, win, w.atom("_NET_REQUEST_FRAME_EXTENTS", false), [5]C.long{},
+			C.SubstructureNotifyMask|C.SubstructureRedirectMask)
+		C.XMapWindow(dpy, win)
+		w.completeStartup()
+	}
+	// Window managers may resize the window when it is mapped,
+	// and the first Expose can precede the ConfigureNotify.
+	// Start with the actual size to avoid drawing a frame at
+	// the requested size.
+	if size, ok := w.windowSize(); ok {
+		w.width, w.height = size.X, size.Y
+	}
+
+	// Every window has its own connection and event loop, so
+	// windows are independent of each other.
+	x11WindowsMu.Lock()
+	x11Windows[dpy] = w
+	x11WindowsMu.Unlock()
 
+	windowOpened()
 	go func() {
 		w.w.SetDriver(w)
 		w.setStage(system.StageRunning)
 		w.loop()
 		w.destroy()
-		close(mainDone)
+		windowClosed()
 	}()
 	return nil
 }
 
-// detectUIScale reports the system UI scale, or 1.0 if it fails.
-func x11DetectUIScale(dpy *C.Display) float32 {
-	// default fixed DPI value used in most desktop UI toolkits
-	const defaultDesktopDPI = 96
+// x11ColorPixel returns the pixel value of the color c in a
+// TrueColor visual with the given channel masks. Alpha is ignored.
+func x11ColorPixel(c color.NRGBA, redMask, greenMask, blueMask uint64) uint64 {
+	channel := func(v uint8, mask uint64) uint64 {
+		if mask == 0 {
+			return 0
+		}
+		shift := bits.TrailingZeros64(mask)
+		max := mask >> shift
+		// Scale to the width of the channel, rounding to
+		// the nearest value.
+		return (uint64(v)*max + 127) / 255 << shift
+	}
+	return channel(c.R, redMask) | channel(c.G, greenMask) | channel(c.B, blueMask)
+}
+
+// x11OpenDisplay connects to the named display. A screen other than -1
+// replaces the screen number of the name, so that it becomes the default
+// screen of the connection, used by Xlib and EGL alike.
+func x11OpenDisplay(name string, screen int) (*C.Display, error) {
+	dpyName := name
+	if screen != -1 {
+		dpyName = x11ScreenDisplayName(name, screen)
+	}
+	var cname *C.char
+	if dpyName != "" {
+		cname = C.CString(dpyName)
+		defer C.free(unsafe.Pointer(cname))
+	}
+	if dpy := C.XOpenDisplay(cname); dpy != nil {
+		C.gio_x11_set_io_exit_handler(dpy)
+		return dpy, nil
+	}
+	if screen != -1 {
+		// Xlib refuses screen numbers out of range; tell them apart
+		// from connection failures.
+		cname := C.CString(name)
+		defer C.free(unsafe.Pointer(cname))
+		if dpy := C.XOpenDisplay(cname); dpy != nil {
+			n := int(C.XScreenCount(dpy))
+			C.XCloseDisplay(dpy)
+			return nil, fmt.Errorf("x11: screen %d out of range; display %q has %d screen(s)", screen, name, n)
+		}
+	}
+	return nil, x11DisplayError(name, os.Getenv("WAYLAND_DISPLAY"))
+}
+
+// x11ScreenDisplayName returns the display name with its screen
+// number replaced by screen. The name has the form
+// [host]:display[.screen].
+func x11ScreenDisplayName(name string, screen int) string {
+	i := strings.LastIndex(name, ":")
+	if i == -1 {
+		// Not a display name; leave the error to Xlib.
+		return name
+	}
+	disp := name[i+1:]
+	if j := strings.Index(disp, "."); j != -1 {
+		disp = disp[:j]
+	}
+	return name[:i+1] + disp + "." + strconv.Itoa(screen)
+}
+
+// x11DisplayError describes a failure to connect to the named
+// display, with a hint for Wayland sessions without Xwayland.
+func x11DisplayError(name, waylandDisplay string) error {
+	if name != "" {
+		return fmt.Errorf("x11: cannot connect to the X server at DISPLAY=%q", name)
+	}
+	if waylandDisplay != "" {
+		return errors.New("x11: cannot connect to the X server: DISPLAY is not set, but WAYLAND_DISPLAY is; " +
+			"build without the nowayland tag to use the Wayland backend, or start Xwayland")
+	}
+	return errors.New("x11: cannot connect to the X server: DISPLAY is not set")
+}
+
+// xdndVersion is the supported version of the XDND protocol.
+const xdndVersion = 5
+
+// handleXdnd handles the XDND messages from a drag source, and
+// reports whether cevt was an XDND message.
+func (w *x11Window) handleXdnd(cevt *C.XClientMessageEvent) bool {
+	data := (*[5]C.long)(unsafe.Pointer(&cevt.data))
+	source := C.Window(data[0])
+	switch cevt.message_type {
+	case w.atoms.xdnd.enter:
+		w.dnd.source = source
+		var types []C.Atom
+		if data[1]&1 != 0 {
+			// More than 3 types are listed in XdndTypeList.
+			types = w.readAtoms(source, w.atoms.xdnd.typeList)
+		} else {
+			for _, t := range data[2:] {
+				types = append(types, C.Atom(t))
+			}
+		}
+		w.dnd.accept = false
+		for _, t := range types {
+			if t == w.atoms.xdnd.uriList {
+				w.dnd.accept = true
+			}
+		}
+	case w.atoms.xdnd.position:
+		if source != w.dnd.source {
+			break
+		}
+		status := [5]C.long{C.long(w.xw)}
+		if w.dnd.accept {
+			status[1] = 1
+			status[4] = C.long(w.atoms.xdnd.actionCopy)
+		}
+		w.sendClientMessage(source, w.xw, w.atoms.xdnd.status, status, C.NoEventMask)
+	case w.atoms.xdnd.leave:
+		w.dnd.source = 0
+	case w.atoms.xdnd.drop:
+		if source != w.dnd.source {
+			break
+		}
+		if !w.dnd.accept {
+			// Refuse drops of unsupported types.
+			w.sendXdndFinished(false)
+			break
+		}
+		C.XDeleteProperty(w.x, w.xw, w.atoms.xdnd.content)
+		C.XConvertSelection(w.x, w.atoms.xdnd.selection, w.atoms.xdnd.uriList,
+			w.atoms.xdnd.content, w.xw, C.Time(data[2]))
+	default:
+		return false
+	}
+	C.XFlush(w.x)
+	return true
+}
+
+// finishDrop delivers the dropped files and completes the drag.
+func (w *x11Window) finishDrop(cevt *C.XSelectionEvent) {
+	if w.dnd.source == 0 {
+		return
+	}
+	var files []string
+	if cevt.property != C.None {
+		if content, ok := w.readProperty(cevt.property); ok {
+			files = parseURIList(string(content))
+		}
+	}
+	w.sendXdndFinished(len(files) > 0)
+	C.XFlush(w.x)
+	if len(files) > 0 {
+		w.w.Event(system.DropEvent{Files: files})
+	}
+}
+
+func (w *x11Window) sendXdndFinished(success bool) {
+	finished := [5]C.long{C.long(w.xw)}
+	if success {
+		finished[1] = 1
+		finished[2] = C.long(w.atoms.xdnd.actionCopy)
+	}
+	w.sendClientMessage(w.dnd.source, w.xw, w.atoms.xdnd.finished, finished, C.NoEventMask)
+	w.dnd.source = 0
+}
+
+// parseURIList returns the local file paths in a text/uri-list,
+// as described by RFC 2483.
+func parseURIList(list string) []string {
+	var files []string
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || u.Scheme != "file" {
+			continue
+		}
+		if u.Host != "" && u.Host != "localhost" {
+			continue
+		}
+		files = append(files, u.Path)
+	}
+	return files
+}
+
+// XEmbed protocol messages and flags.
+const (
+	xembedVersion = 0
+	xembedMapped  = 1 << 0
+
+	xembedEmbeddedNotify   = 0
+	xembedWindowActivate   = 1
+	xembedWindowDeactivate = 2
+	xembedFocusIn          = 4
+	xembedFocusOut         = 5
+)
+
+// embed makes the window an XEmbed client of parent. The
+// embedder maps the window according to _XEMBED_INFO.
+func (w *x11Window) embed(parent C.Window) {
+	info := [2]C.ulong{xembedVersion, xembedMapped}
+	C.XChangeProperty(w.x, w.xw, w.atoms.xembedInfo, w.atoms.xembedInfo, 32, C.PropModeReplace,
+		(*C.uchar)(unsafe.Pointer(&info[0])), C.int(len(info)))
+	C.XReparentWindow(w.x, w.xw, parent, 0, 0)
+}
+
+// handleXEmbed handles the messages from the XEmbed embedder.
+func (w *x11Window) handleXEmbed(cevt *C.XClientMessageEvent) {
+	data := (*[5]C.long)(unsafe.Pointer(&cevt.data))
+	switch data[1] {
+	case xembedEmbeddedNotify:
+		w.embedder = C.Window(data[3])
+	case xembedFocusIn:
+		w.w.Event(key.FocusEvent{Focus: true})
+	case xembedFocusOut:
+		w.w.Event(key.FocusEvent{Focus: false})
+	case xembedWindowActivate, xembedWindowDeactivate:
+		// Focus is reported by the focus messages.
+	}
+}
+
+// updateMonitor determines the monitor containing the center of the
+// window, c in root coordinates, and updates the UI scale if the window
+// moved to a different monitor. It reports whether the scale changed.
+func (w *x11Window) updateMonitor(c image.Point) bool {
+	if !w.randr {
+		return false
+	}
+	// Moves within a monitor are common, such as during an
+	// interactive move, and the monitors rarely change.
+	if w.monitorsValid && c.In(w.monitor.bounds) {
+		return false
+	}
+	if !w.monitorsValid {
+		w.monitors = x11Monitors(w.x)
+		w.monitorsValid = true
+	}
+	mon, ok := x11MonitorAt(w.monitors, c)
+	if !ok || mon == w.monitor {
+		return false
+	}
+	w.monitor = mon
+	w.mu.Lock()
+	w.cfg.refreshRate = mon.refreshRate
+	w.mu.Unlock()
+	return w.setScale(x11MonitorScale(mon, w.resources))
+}
+
+// randrEvent handles the RandR notifications of monitor changes, and
+// reports whether xev was one of them. The monitors are looked up
+// again at the next updateMonitor.
+func (w *x11Window) randrEvent(xev *C.XEvent) bool {
+	if !w.randr {
+		return false
+	}
+	switch (*C.XAnyEvent)(unsafe.Pointer(xev))._type - w.randrEventBase {
+	case C.RRScreenChangeNotify:
+		// Update the screen size known to Xlib.
+		C.XRRUpdateConfiguration(xev)
+	case C.RRNotify:
+		if (*C.XRRNotifyEvent)(unsafe.Pointer(xev)).subtype != C.RRNotify_CrtcChange {
+			return true
+		}
+	default:
+		return false
+	}
+	w.monitorsValid = false
+	return true
+}
+
+// x11ResourceDelay is the delay before changed resources are
+// reloaded, so that a burst of changes causes a single reload.
+const x11ResourceDelay = 200 * time.Millisecond
+
+// resourcesNotify schedules the reload of the resource database
+// after it changed.
+func (w *x11Window) resourcesNotify() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.resourceTimer != nil {
+		return
+	}
+	w.resourceTimer = time.AfterFunc(x11ResourceDelay, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		// A nil timer means that the window is destroyed and
+		// the notification pipe closed.
+		if w.resourceTimer != nil {
+			w.resourcesChanged = true
+			w.wakeup()
+		}
+	})
+}
+
+// reloadResources reads the changed resource database and updates
+// the UI scale. It reports whether the scale changed.
+func (w *x11Window) reloadResources() bool {
+	res, ok := w.rootResources()
+	if !ok || res == w.resources {
+		return false
+	}
+	w.resources = res
+	return w.setScale(x11MonitorScale(w.monitor, res))
+}
+
+// rootResources reads the RESOURCE_MANAGER property of the root
+// window. Unlike XResourceManagerString, it reflects changes made
+// after the connection was opened.
+func (w *x11Window) rootResources() (string, bool) {
+	var (
+		typ        C.Atom
+		format     C.int
+		nitems     C.ulong
+		bytesAfter C.ulong
+		data       *C.uchar
+	)
+	// The resources are always stored on the root window of
+	// the first screen.
+	root := C.XRootWindow(w.x, 0)
+	if C.XGetWindowProperty(w.x, root, w.atoms.resourceManager, 0, 1<<24, C.False, C.XA_STRING,
+		&typ, &format, &nitems, &bytesAfter, &data) != C.Success || data == nil {
+		return "", false
+	}
+	defer C.XFree(unsafe.Pointer(data))
+	if typ != C.XA_STRING || format != 8 {
+		return "", false
+	}
+	return C.GoStringN((*C.char)(unsafe.Pointer(data)), C.int(nitems)), true
+}
+
+// setScale updates the UI scale and reports whether it changed.
+func (w *x11Window) setScale(scale float32) bool {
+	fontScale := scale * x11FontScale(w.fontScale, w.resources)
+	if scale == w.cfg.pxPerDp && fontScale == w.cfg.pxPerSp {
+		return false
+	}
+	w.mu.Lock()
+	w.cfg.pxPerDp = scale
+	w.cfg.pxPerSp = fontScale
+	w.mu.Unlock()
+	// Size constraints are in pixels.
+	w.updateSizeHints()
+	return true
+}
+
+// x11Monitors returns the monitors of the active CRTCs.
+func x11Monitors(dpy *C.Display) []x11Monitor {
+	res := C.XRRGetScreenResourcesCurrent(dpy, C.XDefaultRootWindow(dpy))
+	if res == nil {
+		return nil
+	}
+	defer C.XRRFreeScreenResources(res)
+	var crtcs []C.RRCrtc
+	x11Slice(&crtcs, unsafe.Pointer(res.crtcs), int(res.ncrtc))
+	var modes []C.XRRModeInfo
+	x11Slice(&modes, unsafe.Pointer(res.modes), int(res.nmode))
+	var mons []x11Monitor
+	for _, crtc := range crtcs {
+		info := C.XRRGetCrtcInfo(dpy, res, crtc)
+		if info == nil {
+			continue
+		}
+		if info.mode == C.None {
+			C.XRRFreeCrtcInfo(info)
+			continue
+		}
+		mon := x11Monitor{
+			crtc:   crtc,
+			bounds: image.Rect(int(info.x), int(info.y), int(info.x)+int(info.width), int(info.y)+int(info.height)),
+		}
+		for _, m := range modes {
+			if m.id != info.mode {
+				continue
+			}
+			mon.refreshRate = x11Mode{
+				dotClock:   uint64(m.dotClock),
+				hTotal:     uint32(m.hTotal),
+				vTotal:     uint32(m.vTotal),
+				interlace:  m.modeFlags&C.RR_Interlace != 0,
+				doubleScan: m.modeFlags&C.RR_DoubleScan != 0,
+			}.refreshRate()
+		}
+		if info.noutput > 0 {
+			if out := C.XRRGetOutputInfo(dpy, res, *info.outputs); out != nil {
+				if out.mm_width > 0 {
+					mon.dpi = float32(info.width) * 25.4 / float32(out.mm_width)
+				}
+				C.XRRFreeOutputInfo(out)
+			}
+		}
+		C.XRRFreeCrtcInfo(info)
+		mons = append(mons, mon)
+	}
+	return mons
+}
+
+// x11MonitorAt returns the monitor of mons displaying the point p of
+// the root window, or false if no monitor contains p.
+func x11MonitorAt(mons []x11Monitor, p image.Point) (x11Monitor, bool) {
+	for _, mon := range mons {
+		if p.In(mon.bounds) {
+			return mon, true
+		}
+	}
+	return x11Monitor{}, false
+}
+
+// x11MonitorScale reports the UI scale for a monitor from its physical
+// density. It falls back to the system UI scale from the resource
+// database resources if the density is unknown.
+func x11MonitorScale(mon x11Monitor, resources string) float32 {
+	// Physical sizes are imprecise; round to quarter steps so that
+	// standard density monitors keep a scale of 1.
+	scale := float32(math.Round(float64(mon.dpi/x11DefaultDPI)*4)) / 4
+	if scale <= 0 {
+		return x11ResourceScale(resources)
+	}
+	return scale
+}
+
+// x11ResourceScale reports the system UI scale from a resource
+// database string, or 1.0 if it fails.
+func x11ResourceScale(resources string) float32 {
 	var scale float32 = 1.0
 
 	// Get actual DPI from X resource Xft.dpi (set by GTK and Qt).
 	// This value is entirely based on user preferences and conflates both
 	// screen (UI) scaling and font scale.
-	rms := C.XResourceManagerString(dpy)
-	if rms != nil {
-		db := C.XrmGetStringDatabase(rms)
-		if db != nil {
-			var (
-				t *C.char
-				v C.XrmValue
-			)
-			if C.XrmGetResource(db, (*C.char)(unsafe.Pointer(&[]byte("Xft.dpi\x00")[0])),
-				(*C.char)(unsafe.Pointer(&[]byte("Xft.Dpi\x00")[0])), &t, &v) != C.False {
-				if t != nil && C.GoString(t) == "String" {
-					f, err := strconv.ParseFloat(C.GoString(v.addr), 32)
-					if err == nil {
-						scale = float32(f) / defaultDesktopDPI
-					}
-				}
-			}
-			C.XrmDestroyDatabase(db)
+	if v, ok := x11LookupResource(resources, "Xft.dpi", "Xft.Dpi"); ok {
+		f, err := strconv.ParseFloat(v, 32)
+		if err == nil {
+			scale = float32(f) / x11DefaultDPI
 		}
 	}
 
 	return scale
 }
 
+// x11FontScale returns the scale of text relative to the UI scale.
+// The scale of the options takes precedence over the Gio.fontScale
+// resource, which takes precedence over the default of 1. Xft.dpi is
+// not used, because desktops set it to the UI scale.
+func x11FontScale(opt float32, resources string) float32 {
+	if opt > 0 {
+		return opt
+	}
+	if v, ok := x11LookupResource(resources, "Gio.fontScale", "Gio.FontScale"); ok {
+		f, err := strconv.ParseFloat(v, 32)
+		if err == nil && f > 0 {
+			return float32(f)
+		}
+	}
+	return 1
+}
+
+// x11LoadCursor returns the first cursor of names loaded from the
+// cursor theme, or the cursor created by fallback if the theme has
+// none of them.
+func x11LoadCursor(names []string, load func(name string) uintptr, fallback func() uintptr) uintptr {
+	for _, n := range names {
+		if c := load(n); c != 0 {
+			return c
+		}
+	}
+	return fallback()
+}
+
+// x11CursorTheme returns the cursor theme and size of the
+// Xcursor.theme and Xcursor.size resources. The theme is empty and
+// the size zero if unset.
+func x11CursorTheme(resources string) (string, int) {
+	theme, _ := x11LookupResource(resources, "Xcursor.theme", "Xcursor.Theme")
+	var size int
+	if v, ok := x11LookupResource(resources, "Xcursor.size", "Xcursor.Size"); ok {
+		if s, err := strconv.Atoi(v); err == nil && s > 0 {
+			size = s
+		}
+	}
+	return theme, size
+}
+
+// x11DetectScrollScale returns the scroll distance of a wheel step
+// from the X resource Gio.scrollScale, or the default.
+func x11DetectScrollScale(dpy *C.Display) float32 {
+	if v, ok := x11Resource(dpy, "Gio.scrollScale", "Gio.ScrollScale"); ok {
+		f, err := strconv.ParseFloat(v, 32)
+		if err == nil && f > 0 {
+			return float32(f)
+		}
+	}
+	return x11DefaultScrollScale
+}
+
+// x11Resource looks up a string value in the resource database
+// of the X server.
+func x11Resource(dpy *C.Display, name, class string) (string, bool) {
+	return x11LookupResource(x11ResourceString(dpy), name, class)
+}
+
+// x11ResourceString returns the resource database string of the
+// server at the time the connection was opened.
+func x11ResourceString(dpy *C.Display) string {
+	rms := C.XResourceManagerString(dpy)
+	if rms == nil {
+		return ""
+	}
+	return C.GoString(rms)
+}
+
+// x11LookupResource looks up a string value in a resource
+// database string.
+func x11LookupResource(resources, name, class string) (string, bool) {
+	if resources == "" {
+		return "", false
+	}
+	rms := C.CString(resources)
+	defer C.free(unsafe.Pointer(rms))
+	db := C.XrmGetStringDatabase(rms)
+	if db == nil {
+		return "", false
+	}
+	defer C.XrmDestroyDatabase(db)
+	cname, cclass := C.CString(name), C.CString(class)
+	defer C.free(unsafe.Pointer(cname))
+	defer C.free(unsafe.Pointer(cclass))
+	var (
+		t *C.char
+		v C.XrmValue
+	)
+	if C.XrmGetResource(db, cname, cclass, &t, &v) == C.False {
+		return "", false
+	}
+	if t == nil || C.GoString(t) != "String" {
+		return "", false
+	}
+	return C.GoString(v.addr), true
+}
+
 func (w *x11Window) updateXkbKeymap() error {
 	w.xkb.DestroyKeymapState()
 	ctx := (*C.struct_xkb_context)(unsafe.Pointer(w.xkb.Ctx))
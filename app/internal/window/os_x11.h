@@ -0,0 +1,6 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+__attribute__ ((visibility ("hidden"))) XErrorHandler gio_x11_trap_errors(void);
+__attribute__ ((visibility ("hidden"))) int gio_x11_untrap_errors(Display *dpy, XErrorHandler old);
+__attribute__ ((visibility ("hidden"))) void gio_x11_set_error_handlers(void);
+__attribute__ ((visibility ("hidden"))) void gio_x11_set_io_exit_handler(Display *dpy);
@@ -0,0 +1,1551 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+// +build linux,!android,!nox11 freebsd
+
+package window
+
+import (
+	"bytes"
+	gocontext "context"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gioui.org/app/internal/xkb"
+	"gioui.org/f32"
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/io/system"
+	"gioui.org/unit"
+	syscall "golang.org/x/sys/unix"
+)
+
+func TestX11IconData(t *testing.T) {
+	small := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	small.SetNRGBA(0, 0, color.NRGBA{R: 0x11, G: 0x22, B: 0x33, A: 0x80})
+	large := image.NewRGBA(image.Rect(1, 1, 3, 2))
+	large.SetRGBA(1, 1, color.RGBA{R: 0xff, A: 0xff})
+	// Premultiplied half transparent white.
+	large.SetRGBA(2, 1, color.RGBA{R: 0x80, G: 0x80, B: 0x80, A: 0x80})
+	got := x11IconData([]image.Image{small, large})
+	exp := []uint32{
+		1, 1, 0x80112233,
+		2, 1, 0xffff0000, 0x80ffffff,
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %#x, expected %#x", got, exp)
+	}
+}
+
+func TestX11Opacity(t *testing.T) {
+	tests := []struct {
+		opacity float32
+		exp     uint32
+	}{
+		{-1, 0},
+		{0, 0},
+		{0.5, 0x80000000},
+		{1, 0xffffffff},
+		{2, 0xffffffff},
+	}
+	for _, test := range tests {
+		if got := x11Opacity(test.opacity); got != test.exp {
+			t.Errorf("opacity %v: got %#x, expected %#x", test.opacity, got, test.exp)
+		}
+	}
+}
+
+func TestX11ResizeDirection(t *testing.T) {
+	// The directions are defined by EWMH.
+	exp := map[pointer.Edge]int{
+		pointer.EdgeTopLeft:     0,
+		pointer.EdgeTop:         1,
+		pointer.EdgeTopRight:    2,
+		pointer.EdgeRight:       3,
+		pointer.EdgeBottomRight: 4,
+		pointer.EdgeBottom:      5,
+		pointer.EdgeBottomLeft:  6,
+		pointer.EdgeLeft:        7,
+	}
+	for edge, dir := range exp {
+		if got := x11ResizeDirection(edge); got != dir {
+			t.Errorf("%v: got direction %d, expected %d", edge, got, dir)
+		}
+	}
+}
+
+func TestX11ClickCounter(t *testing.T) {
+	c := x11ClickCounter{interval: x11ClickInterval}
+	pos := image.Pt(10, 10)
+	if n := c.press(pointer.ButtonLeft, pos, 0); n != 1 {
+		t.Errorf("first press: got %d clicks, expected 1", n)
+	}
+	if n := c.press(pointer.ButtonLeft, pos.Add(image.Pt(1, 1)), 200*time.Millisecond); n != 2 {
+		t.Errorf("quick press: got %d clicks, expected 2", n)
+	}
+	if n := c.press(pointer.ButtonLeft, pos, time.Second); n != 1 {
+		t.Errorf("slow press: got %d clicks, expected 1", n)
+	}
+	if n := c.press(pointer.ButtonRight, pos, time.Second+100*time.Millisecond); n != 1 {
+		t.Errorf("other button: got %d clicks, expected 1", n)
+	}
+	c.move(pos.Add(image.Pt(20, 0)))
+	if n := c.press(pointer.ButtonRight, pos, time.Second+200*time.Millisecond); n != 1 {
+		t.Errorf("press after move: got %d clicks, expected 1", n)
+	}
+}
+
+func TestX11StageForState(t *testing.T) {
+	// Iconify and restore the window, then withdraw it.
+	states := []int{x11IconicState, x11NormalState, 0}
+	var got []system.Stage
+	for _, s := range states {
+		if stage, ok := x11StageForState(s); ok {
+			got = append(got, stage)
+		}
+	}
+	exp := []system.Stage{system.StagePaused, system.StageRunning}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got stages %v, expected %v", got, exp)
+	}
+}
+
+func TestX11CoalesceMotion(t *testing.T) {
+	c := &testCallbacks{events: make(chan event.Event, 10)}
+	w := &x11Window{w: c}
+	w.cfg.scrollScale = 10
+	h := newX11EventHandler(w)
+	const (
+		opcode = 131
+		device = 2
+	)
+	// A vertical scroll valuator with a step of 2.
+	w.setScrollValuators(opcode, device, []x11ScrollValuator{{number: 0, increment: 2, valid: true}})
+	// Core motion events, interrupted by a button press.
+	h.inject(x11MotionEvent(image.Pt(1, 1), 0))
+	h.inject(x11MotionEvent(image.Pt(2, 2), 0))
+	h.inject(x11MotionEvent(image.Pt(3, 3), 0))
+	h.inject(x11ButtonEvent(true, 1, image.Pt(3, 3), 0, 0))
+	h.inject(x11MotionEvent(image.Pt(4, 4), 0))
+	// XInput motion events, with scrolling.
+	h.inject(x11XIMotionEvent(opcode, device, image.Pt(5, 5), []float64{2}))
+	h.inject(x11XIMotionEvent(opcode, device, image.Pt(6, 6), []float64{6}))
+	h.inject(x11XIMotionEvent(opcode, device, image.Pt(7, 7), []float64{8}))
+	h.handleEvents()
+	exp := []struct {
+		pos    f32.Point
+		scroll f32.Point
+	}{
+		{pos: f32.Point{X: 3, Y: 3}},
+		{pos: f32.Point{X: 4, Y: 4}},
+		// The scrolling of the three events, 4 steps.
+		{pos: f32.Point{X: 7, Y: 7}, scroll: f32.Point{Y: 40}},
+	}
+	var moves []pointer.Event
+	for len(c.events) > 0 {
+		if e, ok := (<-c.events).(pointer.Event); ok && e.Type == pointer.Move {
+			moves = append(moves, e)
+		}
+	}
+	if len(moves) != len(exp) {
+		t.Fatalf("got %d moves, expected %d", len(moves), len(exp))
+	}
+	for i, e := range exp {
+		if got := moves[i]; got.Position != e.pos || got.Scroll != e.scroll {
+			t.Errorf("move %d: got position %v, scroll %v, expected %v, %v", i, got.Position, got.Scroll, e.pos, e.scroll)
+		}
+	}
+}
+
+func TestX11WheelButtons(t *testing.T) {
+	c := &testCallbacks{events: make(chan event.Event, 10)}
+	w := &x11Window{w: c}
+	w.cfg.scrollScale = 10
+	h := newX11EventHandler(w)
+	const (
+		opcode = 131
+		device = 2
+	)
+	w.setScrollValuators(opcode, device, []x11ScrollValuator{{number: 0, increment: 2, valid: true}})
+	// A wheel without scroll valuators, and one whose buttons
+	// are emulated from the valuators.
+	h.inject(x11XIRawButtonEvent(opcode, 5, false))
+	h.inject(x11ButtonEvent(true, 5, image.Pt(1, 1), 0, 0))
+	h.inject(x11XIRawButtonEvent(opcode, 5, true))
+	h.inject(x11ButtonEvent(true, 5, image.Pt(2, 2), 0, 0))
+	h.handleEvents()
+	var scrolls []pointer.Event
+	for len(c.events) > 0 {
+		if e, ok := (<-c.events).(pointer.Event); ok && e.Scroll != (f32.Point{}) {
+			scrolls = append(scrolls, e)
+		}
+	}
+	if len(scrolls) != 1 || scrolls[0].Position != (f32.Point{X: 1, Y: 1}) {
+		t.Errorf("got scroll events %v, expected one at (1,1)", scrolls)
+	}
+}
+
+type testCallbacks struct {
+	drivers chan Driver
+	events  chan event.Event
+	// destroyed is set when waitEvent sees a DestroyEvent.
+	destroyed bool
+}
+
+func (c *testCallbacks) SetDriver(d Driver) {
+	c.drivers <- d
+}
+
+func (c *testCallbacks) Event(e event.Event) {
+	c.events <- e
+}
+
+// newTestX11Window opens a headless window with opts, where a zero
+// size is replaced by 100x100 dp. The test is skipped without an X
+// server, and the window is destroyed when the test ends.
+//
+// The events channel is unbuffered, so the event loop is held back
+// until the test reads its events.
+func newTestX11Window(t *testing.T, opts *Options) (*x11Window, *testCallbacks) {
+	t.Helper()
+	if os.Getenv("DISPLAY") == "" {
+		t.Skip("no X server; run with a virtual display such as Xvfb")
+	}
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Width.V == 0 {
+		o.Width = unit.Dp(100)
+	}
+	if o.Height.V == 0 {
+		o.Height = unit.Dp(100)
+	}
+	o.Headless = true
+	c := &testCallbacks{
+		drivers: make(chan Driver, 1),
+		events:  make(chan event.Event),
+	}
+	if err := newX11Window(c, &o); err != nil {
+		t.Fatal(err)
+	}
+	w := (<-c.drivers).(*x11Window)
+	t.Cleanup(func() {
+		if !c.destroyed {
+			w.Close()
+			waitEvent(t, c, isDestroyEvent)
+		}
+	})
+	return w, c
+}
+
+// waitEvent returns the first event of c for which pred is true,
+// discarding the events before it.
+func waitEvent(t *testing.T, c *testCallbacks, pred func(e event.Event) bool) event.Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-c.events:
+			if _, ok := e.(system.DestroyEvent); ok {
+				c.destroyed = true
+			}
+			if pred(e) {
+				return e
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for an event")
+		}
+	}
+}
+
+func isFrameEvent(e event.Event) bool {
+	_, ok := e.(FrameEvent)
+	return ok
+}
+
+func isDestroyEvent(e event.Event) bool {
+	_, ok := e.(system.DestroyEvent)
+	return ok
+}
+
+func TestX11HeadlessFrame(t *testing.T) {
+	w, c := newTestX11Window(t, nil)
+	w.Invalidate()
+	waitEvent(t, c, isFrameEvent)
+	w.Close()
+	waitEvent(t, c, isDestroyEvent)
+}
+
+func TestX11MultipleWindows(t *testing.T) {
+	w1, c1 := newTestX11Window(t, nil)
+	w2, c2 := newTestX11Window(t, nil)
+	w1.Close()
+	waitEvent(t, c1, isDestroyEvent)
+	// The other window keeps running.
+	w2.Invalidate()
+	waitEvent(t, c2, isFrameEvent)
+}
+
+func TestX11InjectedEvents(t *testing.T) {
+	ctx, err := xkb.New()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ctx.Destroy()
+	c := &testCallbacks{events: make(chan event.Event, 10)}
+	w := &x11Window{w: c, xkb: ctx, detectableRepeat: true}
+	w.clicks.interval = x11ClickInterval
+	h := newX11EventHandler(w)
+	const keycode = 38
+	pos := image.Pt(10, 20)
+	h.inject(x11KeyEvent(true, keycode))
+	h.inject(x11ButtonEvent(true, 1, pos, time.Second, 0))
+	h.inject(x11ButtonEvent(false, 1, pos, time.Second+100*time.Millisecond, 0))
+	h.handleEvents()
+	if !w.keysDown[keycode] {
+		t.Errorf("key %d not down after KeyPress", keycode)
+	}
+	h.inject(x11KeyEvent(false, keycode))
+	h.handleEvents()
+	if w.keysDown[keycode] {
+		t.Errorf("key %d down after KeyRelease", keycode)
+	}
+	// Without a keymap, the key events are not translated.
+	exp := []pointer.Event{
+		{Type: pointer.Press, Buttons: pointer.ButtonLeft, Clicks: 1, Time: time.Second},
+		{Type: pointer.Release, Clicks: 1, Time: time.Second + 100*time.Millisecond},
+	}
+	for _, e := range exp {
+		e.Source = pointer.Mouse
+		e.Position = f32.Point{X: float32(pos.X), Y: float32(pos.Y)}
+		select {
+		case got := <-c.events:
+			if pe, ok := got.(pointer.Event); ok {
+				// Timestamps depend on the time of the test.
+				if pe.Timestamp.IsZero() {
+					t.Errorf("%v: missing timestamp", pe)
+				}
+				pe.Timestamp = time.Time{}
+				got = pe
+			}
+			if got != e {
+				t.Errorf("got %v, expected %v", got, e)
+			}
+		default:
+			t.Fatalf("missing event %v", e)
+		}
+	}
+	select {
+	case e := <-c.events:
+		t.Errorf("unexpected event %v", e)
+	default:
+	}
+}
+
+func TestX11Clock(t *testing.T) {
+	var c x11Clock
+	now := time.Now()
+	steps := []struct {
+		server uint32
+		// arrival is the time of arrival after now.
+		arrival time.Duration
+		exp     time.Duration
+	}{
+		// The first event synchronizes the clocks.
+		{1000, 0, 0},
+		{1100, 150 * time.Millisecond, 100 * time.Millisecond},
+		// An event can't happen after its arrival.
+		{1300, 250 * time.Millisecond, 250 * time.Millisecond},
+		{1400, 400 * time.Millisecond, 350 * time.Millisecond},
+		// Wrap-around of the server time.
+		{math.MaxUint32, time.Duration(math.MaxUint32-1250) * time.Millisecond, time.Duration(math.MaxUint32-1250) * time.Millisecond},
+		{9, time.Duration(math.MaxUint32-1240) * time.Millisecond, time.Duration(math.MaxUint32-1240) * time.Millisecond},
+	}
+	for _, s := range steps {
+		got := c.Time(s.server, now.Add(s.arrival))
+		if d := got.Sub(now); d != s.exp {
+			t.Errorf("server time %d: got %v after the start, expected %v", s.server, d, s.exp)
+		}
+	}
+}
+
+func TestX11ColorPixel(t *testing.T) {
+	tests := []struct {
+		c                color.NRGBA
+		red, green, blue uint64
+		pixel            uint64
+	}{
+		// 24 bit RGB.
+		{color.NRGBA{R: 0x12, G: 0x34, B: 0x56, A: 0xff}, 0xff0000, 0x00ff00, 0x0000ff, 0x123456},
+		// Alpha is ignored.
+		{color.NRGBA{R: 0x12, G: 0x34, B: 0x56, A: 0x80}, 0xff0000, 0x00ff00, 0x0000ff, 0x123456},
+		// 24 bit BGR.
+		{color.NRGBA{R: 0x12, G: 0x34, B: 0x56, A: 0xff}, 0x0000ff, 0x00ff00, 0xff0000, 0x563412},
+		// 16 bit RGB 5:6:5.
+		{color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, 0xf800, 0x07e0, 0x001f, 0xffff},
+		{color.NRGBA{R: 0xff, G: 0x80, B: 0x00, A: 0xff}, 0xf800, 0x07e0, 0x001f, 0xfc00},
+		// 30 bit RGB.
+		{color.NRGBA{R: 0xff, G: 0x00, B: 0x80, A: 0xff}, 0x3ff00000, 0x000ffc00, 0x000003ff, 0x3ff00202},
+	}
+	for _, test := range tests {
+		if got := x11ColorPixel(test.c, test.red, test.green, test.blue); got != test.pixel {
+			t.Errorf("color %v, masks %#x %#x %#x: got pixel %#x, expected %#x", test.c, test.red, test.green, test.blue, got, test.pixel)
+		}
+	}
+}
+
+func TestX11VisibilityEvents(t *testing.T) {
+	c := &testCallbacks{events: make(chan event.Event, 10)}
+	w := &x11Window{w: c}
+	h := newX11EventHandler(w)
+	steps := []struct {
+		inject func()
+		exp    system.VisibilityEvent
+	}{
+		{func() { h.inject(x11MapEvent(true)) }, system.VisibilityEvent{Visible: true}},
+		{func() { h.inject(x11VisibilityEvent(true)) }, system.VisibilityEvent{Visible: true, Obscured: true}},
+		{func() { h.inject(x11MapEvent(false)) }, system.VisibilityEvent{}},
+	}
+	for i, s := range steps {
+		s.inject()
+		h.handleEvents()
+		var got []system.VisibilityEvent
+	events:
+		for {
+			select {
+			case e := <-c.events:
+				if e, ok := e.(system.VisibilityEvent); ok {
+					got = append(got, e)
+				}
+			default:
+				break events
+			}
+		}
+		if len(got) != 1 || got[0] != s.exp {
+			t.Errorf("step %d: got %v, expected %v", i, got, s.exp)
+		}
+	}
+}
+
+func TestX11InjectEvents(t *testing.T) {
+	c := &testCallbacks{events: make(chan event.Event, 10)}
+	w := &x11Window{w: c, coalesceEdits: true}
+	w.clicks.interval = x11ClickInterval
+	h := newX11EventHandler(w)
+	pos := image.Pt(10, 20)
+	h.inject(x11FocusEvent(true))
+	h.inject(x11ButtonEvent(true, 1, pos, time.Second, 0))
+	h.inject(x11ButtonEvent(false, 1, pos, time.Second+100*time.Millisecond, 0))
+	h.inject(x11FocusEvent(false))
+	h.handleEvents()
+	// The events are delivered in order, through the same path as
+	// the events of the X server.
+	exp := []event.Event{
+		key.FocusEvent{Focus: true},
+		pointer.Event{Type: pointer.Press, Buttons: pointer.ButtonLeft},
+		pointer.Event{Type: pointer.Release},
+		key.FocusEvent{Focus: false},
+	}
+	for _, e := range exp {
+		select {
+		case got := <-c.events:
+			if pe, ok := got.(pointer.Event); ok {
+				got = pointer.Event{Type: pe.Type, Buttons: pe.Buttons}
+			}
+			if got != e {
+				t.Errorf("got %v, expected %v", got, e)
+			}
+		default:
+			t.Fatalf("missing event %v", e)
+		}
+	}
+	select {
+	case e := <-c.events:
+		t.Errorf("unexpected event %v", e)
+	default:
+	}
+}
+
+func TestX11CoalesceEdits(t *testing.T) {
+	c := &testCallbacks{events: make(chan event.Event, 20)}
+	w := &x11Window{w: c, coalesceEdits: true}
+	// Events in the order of xkb.Context.DispatchKey.
+	for _, r := range "abc" {
+		w.keyEvent(key.Event{Name: strings.ToUpper(string(r)), State: key.Press})
+		w.keyEvent(key.EditEvent{Text: string(r)})
+	}
+	w.keyEvent(key.Event{Name: key.NameLeftArrow, State: key.Press})
+	w.keyEvent(key.EditEvent{Text: "d"})
+	w.flushEdit()
+	exp := []event.Event{
+		key.Event{Name: "A", State: key.Press},
+		key.Event{Name: "B", State: key.Press},
+		key.Event{Name: "C", State: key.Press},
+		key.EditEvent{Text: "abc"},
+		key.Event{Name: key.NameLeftArrow, State: key.Press},
+		key.EditEvent{Text: "d"},
+	}
+	for _, e := range exp {
+		select {
+		case got := <-c.events:
+			if got != e {
+				t.Errorf("got %v, expected %v", got, e)
+			}
+		default:
+			t.Fatalf("missing event %v", e)
+		}
+	}
+	select {
+	case e := <-c.events:
+		t.Errorf("unexpected event %v", e)
+	default:
+	}
+}
+
+func TestX11ModeRefreshRate(t *testing.T) {
+	tests := []struct {
+		// mode line: pixel clock in MHz and the horizontal
+		// and vertical timings.
+		modeline string
+		flags    string
+		hz       float32
+	}{
+		{"148.50 1920 2008 2052 2200 1080 1084 1089 1125", "", 60},
+		{"297.00 1920 2008 2052 2200 1080 1084 1089 1125", "", 120},
+		{"74.25 1920 2008 2052 2200 1080 1084 1094 1125", "interlace", 60},
+		{"25.20 320 328 376 400 240 245 247 262", "doublescan", 120.2},
+	}
+	for _, test := range tests {
+		var (
+			clock                       float64
+			hdisp, hstart, hend, htotal uint32
+			vdisp, vstart, vend, vtotal uint32
+		)
+		if _, err := fmt.Sscan(test.modeline, &clock, &hdisp, &hstart, &hend, &htotal, &vdisp, &vstart, &vend, &vtotal); err != nil {
+			t.Fatal(err)
+		}
+		m := x11Mode{
+			dotClock:   uint64(math.Round(clock * 1e6)),
+			hTotal:     htotal,
+			vTotal:     vtotal,
+			interlace:  test.flags == "interlace",
+			doubleScan: test.flags == "doublescan",
+		}
+		if hz := m.refreshRate(); math.Abs(float64(hz-test.hz)) > 0.1 {
+			t.Errorf("%q: got %.2f Hz, expected %.2f Hz", test.modeline, hz, test.hz)
+		}
+	}
+}
+
+func TestX11DisplayError(t *testing.T) {
+	tests := []struct {
+		display, wayland string
+		msg              string
+	}{
+		{":1", "", `DISPLAY=":1"`},
+		{"", "", "DISPLAY is not set"},
+		{"", "wayland-0", "Wayland backend"},
+	}
+	for _, test := range tests {
+		err := x11DisplayError(test.display, test.wayland)
+		if !strings.Contains(err.Error(), test.msg) {
+			t.Errorf("DISPLAY=%q WAYLAND_DISPLAY=%q: got %q, expected it to contain %q", test.display, test.wayland, err, test.msg)
+		}
+	}
+}
+
+func TestX11PollError(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	fds := []syscall.PollFd{{Fd: int32(r.Fd()), Events: syscall.POLLIN | syscall.POLLERR | syscall.POLLHUP}}
+	if _, err := syscall.Poll(fds, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := x11PollError(fds[0].Revents); err != nil {
+		t.Errorf("open connection: got error %v", err)
+	}
+	// Closing the other end is like the X server going away.
+	w.Close()
+	if _, err := syscall.Poll(fds, -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := x11PollError(fds[0].Revents); err == nil || !strings.Contains(err.Error(), "closed the connection") {
+		t.Errorf("closed connection: got error %v", err)
+	}
+}
+
+func TestX11NoDisplay(t *testing.T) {
+	if d, ok := os.LookupEnv("DISPLAY"); ok {
+		defer os.Setenv("DISPLAY", d)
+	}
+	os.Unsetenv("DISPLAY")
+	err := newX11Window(&testCallbacks{}, &Options{})
+	if err == nil || !strings.Contains(err.Error(), "DISPLAY is not set") {
+		t.Errorf("got error %v, expected a DISPLAY hint", err)
+	}
+}
+
+func TestX11ServePrimarySelection(t *testing.T) {
+	w, c := newTestX11Window(t, nil)
+	const content = "selected text"
+	w.SetPrimarySelection(content)
+	// Answer a request from the window itself; the response
+	// arrives as a SelectionNotify event.
+	req := w.selfSelectionRequest(true, "UTF8_STRING")
+	w.serveSelection(&req)
+	e := waitEvent(t, c, func(e event.Event) bool {
+		_, ok := e.(system.PrimarySelectionEvent)
+		return ok
+	})
+	if got := e.(system.PrimarySelectionEvent).Text; got != content {
+		t.Errorf("got %q, expected %q", got, content)
+	}
+}
+
+func TestX11ServeClipboardMIME(t *testing.T) {
+	w, c := newTestX11Window(t, nil)
+	const content = "copied text"
+	w.WriteClipboard(content)
+	// A single text write is served in several targets.
+	for _, target := range []string{"UTF8_STRING", "text/plain;charset=utf-8"} {
+		w.startSelectionRead(gocontext.Background(), 0, w.atoms.clipboardContent, target)
+		req := w.selfSelectionRequest(false, target)
+		w.serveSelection(&req)
+		e := waitClipboard(t, c)
+		if e.Text != content || e.MIME != x11TextMIME {
+			t.Errorf("%s: got %q of type %q, expected %q", target, e.Text, e.MIME, content)
+		}
+	}
+	png := []byte("\x89PNG\r\n\x1a\n")
+	w.WriteClipboardMIME("image/png", png)
+	w.startSelectionRead(gocontext.Background(), 0, w.atoms.clipboardContent, "image/png")
+	req := w.selfSelectionRequest(false, "image/png")
+	w.serveSelection(&req)
+	if e := waitClipboard(t, c); e.MIME != "image/png" || string(e.Data) != string(png) {
+		t.Errorf("got %q of type %q, expected %q", e.Data, e.MIME, png)
+	}
+	// Text is no longer served after an image write.
+	req = w.selfSelectionRequest(false, "UTF8_STRING")
+	w.serveSelection(&req)
+	if e := waitClipboard(t, c); e.MIME != "" {
+		t.Errorf("got %q of type %q, expected no content", e.Data, e.MIME)
+	}
+}
+
+func TestX11ClipboardTimeout(t *testing.T) {
+	c := &testCallbacks{events: make(chan event.Event, 10)}
+	w := &x11Window{w: c}
+	pipe := make([]int, 2)
+	if err := syscall.Pipe2(pipe, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(pipe[0])
+	defer syscall.Close(pipe[1])
+	w.notify.read, w.notify.write = pipe[0], pipe[1]
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	reads := []struct {
+		start func()
+		err   error
+	}{
+		{func() {
+			w.startSelectionRead(gocontext.Background(), 10*time.Millisecond, w.atoms.clipboardContent, x11TextMIME)
+		}, gocontext.DeadlineExceeded},
+		{func() {
+			w.startSelectionRead(ctx, 0, w.atoms.clipboardContent, "image/png")
+			cancel()
+		}, gocontext.Canceled},
+	}
+	for _, read := range reads {
+		// No owner responds to the read.
+		read.start()
+		fds := []syscall.PollFd{{Fd: int32(w.notify.read), Events: syscall.POLLIN}}
+		if n, err := syscall.Poll(fds, 5000); err != nil || n == 0 {
+			t.Fatalf("no wakeup after the read expired (err: %v)", err)
+		}
+		syscall.Read(w.notify.read, make([]byte, 100))
+		w.expireSelectionReads()
+		select {
+		case e := <-c.events:
+			if e, ok := e.(system.ClipboardEvent); !ok || e.Err != read.err {
+				t.Errorf("got %#v, expected a system.ClipboardEvent with error %v", e, read.err)
+			}
+		default:
+			t.Errorf("no event for an expired read, expected error %v", read.err)
+		}
+		// Late replies are ignored.
+		if w.pendingSelectionRead(w.atoms.clipboardContent) != nil {
+			t.Error("expired read is still pending")
+		}
+	}
+}
+
+func TestX11ClipboardLost(t *testing.T) {
+	c := &testCallbacks{events: make(chan event.Event, 10)}
+	w := &x11Window{w: c}
+	h := newX11EventHandler(w)
+	w.clipboard = x11Selection{mime: "image/png", data: make([]byte, 1<<20)}
+	w.primary = x11Selection{mime: x11TextMIME, data: []byte("selected")}
+	h.inject(w.selectionClearEvent(true))
+	h.handleEvents()
+	if w.primary.data != nil {
+		t.Error("PRIMARY content not released after SelectionClear")
+	}
+	select {
+	case e := <-c.events:
+		t.Errorf("got %#v for PRIMARY, expected no event", e)
+	default:
+	}
+	h.inject(w.selectionClearEvent(false))
+	h.handleEvents()
+	if w.clipboard.data != nil {
+		t.Error("CLIPBOARD content not released after SelectionClear")
+	}
+	select {
+	case e := <-c.events:
+		if _, ok := e.(system.ClipboardLostEvent); !ok {
+			t.Errorf("got %#v, expected system.ClipboardLostEvent", e)
+		}
+	default:
+		t.Error("no event after SelectionClear")
+	}
+}
+
+func waitClipboard(t *testing.T, c *testCallbacks) system.ClipboardEvent {
+	t.Helper()
+	e := waitEvent(t, c, func(e event.Event) bool {
+		_, ok := e.(system.ClipboardEvent)
+		return ok
+	})
+	return e.(system.ClipboardEvent)
+}
+
+func TestX11MIMETargets(t *testing.T) {
+	tests := []struct {
+		mime    string
+		targets []string
+	}{
+		{"", nil},
+		{"text/plain;charset=utf-8", []string{"UTF8_STRING", "text/plain;charset=utf-8", "text/plain"}},
+		{"UTF8_STRING", []string{"UTF8_STRING", "text/plain;charset=utf-8", "text/plain"}},
+		{"text/html", []string{"text/html"}},
+		{"image/png", []string{"image/png"}},
+	}
+	for _, test := range tests {
+		got := x11MIMETargets(test.mime)
+		if !reflect.DeepEqual(got, test.targets) {
+			t.Errorf("%q: got targets %q, expected %q", test.mime, got, test.targets)
+		}
+	}
+}
+
+func TestX11BestTarget(t *testing.T) {
+	const (
+		utf8String = 10 + iota
+		str
+		textPlain
+		imagePNG
+	)
+	prefs := []uint64{utf8String, str, textPlain}
+	tests := []struct {
+		offered []uint64
+		exp     int
+	}{
+		{[]uint64{textPlain, str, utf8String}, 0},
+		{[]uint64{imagePNG, textPlain, str}, 1},
+		{[]uint64{textPlain}, 2},
+		{[]uint64{imagePNG}, -1},
+		{nil, -1},
+	}
+	for _, test := range tests {
+		if got := x11BestTarget(test.offered, prefs); got != test.exp {
+			t.Errorf("offered %v: got %d, expected %d", test.offered, got, test.exp)
+		}
+	}
+}
+
+func TestX11Latin1ToUTF8(t *testing.T) {
+	if got, exp := x11Latin1ToUTF8([]byte("caf\xe9")), "café"; got != exp {
+		t.Errorf("got %q, expected %q", got, exp)
+	}
+}
+
+func TestParseURIList(t *testing.T) {
+	list := "# comment\r\n" +
+		"file:///home/user/a%20file.txt\r\n" +
+		"file://localhost/tmp/b\r\n" +
+		"file://otherhost/tmp/c\r\n" +
+		"https://example.com/d\r\n"
+	got := parseURIList(list)
+	exp := []string{"/home/user/a file.txt", "/tmp/b"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %q, expected %q", got, exp)
+	}
+}
+
+func TestX11ReleaseGrab(t *testing.T) {
+	// GrabPointer during a drag with the left button.
+	grabbed := true
+	// Releasing the right button keeps the grab.
+	if x11ReleaseGrab(grabbed, pointer.ButtonLeft) {
+		t.Error("grab released with a button pressed")
+	}
+	// Releasing the last button ends it.
+	if !x11ReleaseGrab(grabbed, 0) {
+		t.Error("grab kept after the last button release")
+	}
+	// Without a grab, there is nothing to release.
+	if x11ReleaseGrab(false, 0) {
+		t.Error("release without a grab")
+	}
+}
+
+func TestX11ModifierMask(t *testing.T) {
+	tests := []struct {
+		mods key.Modifiers
+		mask uint
+	}{
+		{0, 0},
+		{key.ModShift, 1 << 0},
+		{key.ModCtrl | key.ModAlt, 1<<2 | 1<<3},
+		{key.ModSuper, 1 << 6},
+	}
+	for _, test := range tests {
+		if got := x11ModifierMask(test.mods); got != test.mask {
+			t.Errorf("%v: got mask %#x, expected %#x", test.mods, got, test.mask)
+		}
+	}
+}
+
+func TestX11ConfigureRedraw(t *testing.T) {
+	c := &testCallbacks{events: make(chan event.Event, 10)}
+	w := &x11Window{w: c, width: 100, height: 100}
+	h := newX11EventHandler(w)
+	h.inject(x11ConfigureEvent(image.Rect(50, 50, 150, 150)))
+	if h.handleEvents() {
+		t.Error("move: got redraw, expected none")
+	}
+	h.inject(x11ConfigureEvent(image.Rect(50, 50, 250, 200)))
+	if !h.handleEvents() {
+		t.Error("resize: got no redraw")
+	}
+	if w.width != 200 || w.height != 150 {
+		t.Errorf("resize: got size %dx%d, expected 200x150", w.width, w.height)
+	}
+}
+
+func TestX11Bounds(t *testing.T) {
+	c := &testCallbacks{events: make(chan event.Event, 10)}
+	w := &x11Window{w: c}
+	w.extents = FrameExtentsEvent{Left: 1, Right: 2, Top: 20, Bottom: 3}
+	h := newX11EventHandler(w)
+	h.inject(x11ConfigureEvent(image.Rect(50, 60, 150, 260)))
+	h.handleEvents()
+	exp := image.Rect(49, 40, 152, 263)
+	for {
+		select {
+		case e := <-c.events:
+			if e, ok := e.(BoundsEvent); ok {
+				if e.Bounds != exp {
+					t.Errorf("got bounds %v, expected %v", e.Bounds, exp)
+				}
+				return
+			}
+		default:
+			t.Fatal("no BoundsEvent")
+		}
+	}
+}
+
+func TestX11Focused(t *testing.T) {
+	c := &testCallbacks{events: make(chan event.Event, 10)}
+	w := &x11Window{w: c}
+	h := newX11EventHandler(w)
+	h.inject(x11FocusEvent(true))
+	h.handleEvents()
+	if !w.Focused() {
+		t.Error("window not focused after FocusIn")
+	}
+	h.inject(x11FocusEvent(false))
+	h.handleEvents()
+	if w.Focused() {
+		t.Error("window focused after FocusOut")
+	}
+}
+
+func TestX11StartupMessage(t *testing.T) {
+	tests := []struct {
+		id, msg string
+	}{
+		{"gio-1234_TIME5678", `remove: ID=gio-1234_TIME5678`},
+		{`a b"c\d`, `remove: ID="a b\"c\\d"`},
+	}
+	for _, test := range tests {
+		if got := x11StartupMessage(test.id); got != test.msg {
+			t.Errorf("x11StartupMessage(%q) = %q, expected %q", test.id, got, test.msg)
+		}
+	}
+	msg := x11StartupMessage("a-startup-id-longer-than-20")
+	chunks := x11StartupChunks(msg)
+	if len(chunks) != 2 {
+		t.Fatalf("got %d chunks, expected 2", len(chunks))
+	}
+	var joined []byte
+	for _, c := range chunks {
+		joined = append(joined, c[:]...)
+	}
+	if got := string(joined[:len(msg)]); got != msg {
+		t.Errorf("chunks contain %q, expected %q", got, msg)
+	}
+	for _, b := range joined[len(msg):] {
+		if b != 0 {
+			t.Fatalf("message not nul terminated: %q", joined)
+		}
+	}
+}
+
+func TestX11UrgencyFlags(t *testing.T) {
+	// XUrgencyHint is bit 8 of the XWMHints flags.
+	const inputHint, urgencyHint = 1 << 0, 1 << 8
+	flags := x11UrgencyFlags(inputHint, true)
+	if flags != inputHint|urgencyHint {
+		t.Errorf("got flags %#x after setting urgency, expected %#x", flags, inputHint|urgencyHint)
+	}
+	if f := x11UrgencyFlags(flags, true); f != flags {
+		t.Errorf("setting urgency twice changed the flags to %#x", f)
+	}
+	flags = x11UrgencyFlags(flags, false)
+	if flags != inputHint {
+		t.Errorf("got flags %#x after clearing urgency, expected %#x", flags, inputHint)
+	}
+}
+
+func TestX11Touches(t *testing.T) {
+	touches := make(x11Touches)
+	// XInput touch ids are not reused.
+	if id := touches.begin(100); id != 0 {
+		t.Errorf("first touch: got ID %d, expected 0", id)
+	}
+	if id := touches.begin(101); id != 1 {
+		t.Errorf("second touch: got ID %d, expected 1", id)
+	}
+	if id, ok := touches.end(100); !ok || id != 0 {
+		t.Errorf("end of first touch: got ID %d, %v, expected 0", id, ok)
+	}
+	// The lowest free ID is reused.
+	if id := touches.begin(102); id != 0 {
+		t.Errorf("third touch: got ID %d, expected 0", id)
+	}
+	if id := touches[101]; id != 1 {
+		t.Errorf("second touch changed ID to %d", id)
+	}
+	if _, ok := touches.end(100); ok {
+		t.Error("ended touch still known")
+	}
+}
+
+func TestX11ScreenDisplayName(t *testing.T) {
+	tests := []struct {
+		name   string
+		screen int
+		exp    string
+	}{
+		{":0", 1, ":0.1"},
+		{":0.0", 1, ":0.1"},
+		{"host:10.2", 0, "host:10.0"},
+		{"[::1]:0", 1, "[::1]:0.1"},
+		{"", 1, ""},
+	}
+	for _, test := range tests {
+		if got := x11ScreenDisplayName(test.name, test.screen); got != test.exp {
+			t.Errorf("%q, screen %d: got %q, expected %q", test.name, test.screen, got, test.exp)
+		}
+	}
+}
+
+func TestX11ExposeDamage(t *testing.T) {
+	c := &testCallbacks{events: make(chan event.Event, 10)}
+	w := &x11Window{w: c, width: 200, height: 200}
+	h := newX11EventHandler(w)
+	h.inject(x11ExposeEvent(image.Rect(10, 10, 20, 20), 2))
+	h.inject(x11ExposeEvent(image.Rect(50, 5, 60, 15), 1))
+	if h.handleEvents() {
+		t.Error("got redraw before the last Expose")
+	}
+	h.inject(x11ExposeEvent(image.Rect(0, 30, 5, 40), 0))
+	if !h.handleEvents() {
+		t.Error("got no redraw after the last Expose")
+	}
+	if exp := image.Rect(0, 5, 60, 40); w.damage != exp {
+		t.Errorf("got damage %v, expected %v", w.damage, exp)
+	}
+}
+
+func TestX11MonitorAt(t *testing.T) {
+	mons := []x11Monitor{
+		{bounds: image.Rect(0, 0, 1920, 1080), dpi: 96},
+		{bounds: image.Rect(1920, 0, 3840, 2160), dpi: 192},
+	}
+	tests := []struct {
+		p   image.Point
+		dpi float32
+		ok  bool
+	}{
+		{image.Pt(100, 100), 96, true},
+		{image.Pt(1920, 100), 192, true},
+		// Below the smaller monitor.
+		{image.Pt(100, 1500), 0, false},
+	}
+	for _, test := range tests {
+		mon, ok := x11MonitorAt(mons, test.p)
+		if ok != test.ok || mon.dpi != test.dpi {
+			t.Errorf("%v: got monitor %+v, %v, expected dpi %v, %v", test.p, mon, ok, test.dpi, test.ok)
+		}
+	}
+}
+
+func TestX11ResourceScale(t *testing.T) {
+	tests := []struct {
+		resources string
+		scale     float32
+	}{
+		{"", 1},
+		{"Xft.antialias:\t1\n", 1},
+		{"Xft.antialias:\t1\nXft.dpi:\t192\n", 2},
+		{"Xft.dpi: 120\n", 1.25},
+	}
+	for _, test := range tests {
+		if got := x11ResourceScale(test.resources); got != test.scale {
+			t.Errorf("%q: got scale %v, expected %v", test.resources, got, test.scale)
+		}
+	}
+	// The physical density of a monitor takes precedence.
+	if got := x11MonitorScale(x11Monitor{dpi: 96}, "Xft.dpi: 192\n"); got != 1 {
+		t.Errorf("got monitor scale %v, expected 1", got)
+	}
+	if got := x11MonitorScale(x11Monitor{}, "Xft.dpi: 192\n"); got != 2 {
+		t.Errorf("got fallback scale %v, expected 2", got)
+	}
+}
+
+func TestX11FontScale(t *testing.T) {
+	tests := []struct {
+		opt       float32
+		resources string
+		scale     float32
+	}{
+		{0, "", 1},
+		{0, "Gio.fontScale: 1.5\n", 1.5},
+		{0, "Gio.fontScale: invalid\n", 1},
+		{0, "Gio.fontScale: -2\n", 1},
+		{2, "", 2},
+		{2, "Gio.fontScale: 1.5\n", 2},
+		// Xft.dpi is the UI scale, not the font scale.
+		{0, "Xft.dpi: 192\n", 1},
+	}
+	for _, test := range tests {
+		if got := x11FontScale(test.opt, test.resources); got != test.scale {
+			t.Errorf("option %v, resources %q: got %v, expected %v", test.opt, test.resources, got, test.scale)
+		}
+	}
+}
+
+func TestX11CursorTheme(t *testing.T) {
+	tests := []struct {
+		resources string
+		theme     string
+		size      int
+	}{
+		{"", "", 0},
+		{"Xcursor.theme: Adwaita\nXcursor.size: 48\n", "Adwaita", 48},
+		{"Xcursor.theme: breeze_cursors\n", "breeze_cursors", 0},
+		{"Xcursor.size: invalid\n", "", 0},
+		{"Xcursor.size: -24\n", "", 0},
+	}
+	for _, test := range tests {
+		theme, size := x11CursorTheme(test.resources)
+		if theme != test.theme || size != test.size {
+			t.Errorf("resources %q: got theme %q, size %d, expected %q, %d", test.resources, theme, size, test.theme, test.size)
+		}
+	}
+}
+
+func TestX11LoadCursor(t *testing.T) {
+	names := x11Cursors[pointer.CursorText].names
+	tests := []struct {
+		theme  map[string]uintptr
+		cursor uintptr
+	}{
+		// CSS names take precedence.
+		{map[string]uintptr{"text": 1, "xterm": 2}, 1},
+		// Older themes use the cursor font names.
+		{map[string]uintptr{"xterm": 2}, 2},
+		// No theme falls back to the cursor font.
+		{nil, 3},
+	}
+	for _, test := range tests {
+		got := x11LoadCursor(names, func(name string) uintptr {
+			return test.theme[name]
+		}, func() uintptr {
+			return 3
+		})
+		if got != test.cursor {
+			t.Errorf("theme %v: got cursor %d, expected %d", test.theme, got, test.cursor)
+		}
+	}
+}
+
+func TestX11Invalidate(t *testing.T) {
+	w, c := newTestX11Window(t, nil)
+	w.Invalidate()
+	frames := 0
+	// Count the frames until the window is idle.
+	idle := time.After(500 * time.Millisecond)
+	for {
+		select {
+		case e := <-c.events:
+			if _, ok := e.(FrameEvent); ok {
+				frames++
+			}
+		case <-idle:
+			if frames != 1 {
+				t.Errorf("got %d frames after Invalidate, expected 1", frames)
+			}
+			return
+		}
+	}
+}
+
+func TestX11FrameDelay(t *testing.T) {
+	now := time.Unix(100, 0)
+	tests := []struct {
+		last     time.Time
+		interval time.Duration
+		delay    time.Duration
+	}{
+		{now.Add(-time.Millisecond), 0, 0},
+		{time.Time{}, 50 * time.Millisecond, 0},
+		{now.Add(-10 * time.Millisecond), 50 * time.Millisecond, 40 * time.Millisecond},
+		{now.Add(-50 * time.Millisecond), 50 * time.Millisecond, 0},
+		{now.Add(-time.Second), 50 * time.Millisecond, 0},
+	}
+	for _, test := range tests {
+		if got := x11FrameDelay(test.last, now, test.interval); got != test.delay {
+			t.Errorf("x11FrameDelay(%v, %v) = %v, expected %v", now.Sub(test.last), test.interval, got, test.delay)
+		}
+	}
+}
+
+func TestX11InitialSize(t *testing.T) {
+	w, c := newTestX11Window(t, nil)
+	size, ok := w.windowSize()
+	if !ok {
+		t.Fatal("failed to query the window size")
+	}
+	w.Invalidate()
+	e := waitEvent(t, c, isFrameEvent).(FrameEvent)
+	// The first frame has the size of the window, not the
+	// size of the options.
+	if e.Size != size {
+		t.Errorf("got frame size %v, expected window size %v", e.Size, size)
+	}
+}
+
+func TestX11MaxFPS(t *testing.T) {
+	w, c := newTestX11Window(t, &Options{MaxFPS: 20})
+	// Flood the window with invalidations.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				w.Invalidate()
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+	var frames []time.Time
+	timeout := time.After(time.Second)
+	for len(frames) < 5 {
+		select {
+		case e := <-c.events:
+			if e, ok := e.(FrameEvent); ok && !e.Sync {
+				frames = append(frames, time.Now())
+			}
+		case <-timeout:
+			t.Fatalf("got %d frames in a second, expected at least 5", len(frames))
+		}
+	}
+	// Allow for scheduling jitter.
+	const minInterval = 40 * time.Millisecond
+	for i := 1; i < len(frames); i++ {
+		if d := frames[i].Sub(frames[i-1]); d < minInterval {
+			t.Errorf("frame %d after %v, expected at least %v", i, d, minInterval)
+		}
+	}
+}
+
+func TestX11ForwardWakeups(t *testing.T) {
+	w := new(x11Window)
+	pipe := make([]int, 2)
+	if err := syscall.Pipe2(pipe, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(pipe[0])
+	defer syscall.Close(pipe[1])
+	w.notify.read, w.notify.write = pipe[0], pipe[1]
+	ch := make(chan struct{})
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		w.forwardWakeups(ch, stop)
+		close(done)
+	}()
+	ch <- struct{}{}
+	fds := []syscall.PollFd{{Fd: int32(w.notify.read), Events: syscall.POLLIN}}
+	if n, err := syscall.Poll(fds, 5000); err != nil || n == 0 {
+		t.Fatalf("no wakeup after a send (err: %v)", err)
+	}
+	w.mu.Lock()
+	invalidated := w.invalidated
+	w.mu.Unlock()
+	if !invalidated {
+		t.Error("window not invalidated after a send")
+	}
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("forwardWakeups didn't return after stop")
+	}
+}
+
+func TestX11SetTitle(t *testing.T) {
+	w, _ := newTestX11Window(t, &Options{Title: "before"})
+	// The window is idle, so the new title reaches the server
+	// only if SetTitle flushes it.
+	const title = "after"
+	w.SetTitle(title)
+	_, win := w.NativeWindow()
+	timeout := time.Now().Add(5 * time.Second)
+	for {
+		got, err := x11FetchTitle(win)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == title {
+			return
+		}
+		if time.Now().After(timeout) {
+			t.Fatalf("got title %q, expected %q", got, title)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestX11PingReply(t *testing.T) {
+	const (
+		root     = 1
+		win      = 2
+		pingAtom = 3
+	)
+	ping := ClientMessage{Window: win, Format: 32, Longs: [5]int64{pingAtom, 1234, win}}
+	xev := x11ClientMessageEvent(ping)
+	reply := x11PingReply(&xev, root)
+	got := x11ClientMessage(&reply)
+	// The reply is the ping, sent to the root window.
+	if got.Window != root || got.Format != 32 || got.Longs != ping.Longs {
+		t.Errorf("got reply %+v, expected %v with window %d", got, ping.Longs, root)
+	}
+}
+
+func TestX11ProcessHints(t *testing.T) {
+	host, err := os.Hostname()
+	if err != nil {
+		t.Skip(err)
+	}
+	w, _ := newTestX11Window(t, nil)
+	gotPID, gotHost := w.processHints()
+	if pid := os.Getpid(); gotPID != pid {
+		t.Errorf("got _NET_WM_PID %d, expected %d", gotPID, pid)
+	}
+	if gotHost != host {
+		t.Errorf("got WM_CLIENT_MACHINE %q, expected %q", gotHost, host)
+	}
+}
+
+func TestX11Role(t *testing.T) {
+	const role = "preferences"
+	w, _ := newTestX11Window(t, &Options{Role: role})
+	if got := w.role(); got != role {
+		t.Errorf("got WM_WINDOW_ROLE %q, expected %q", got, role)
+	}
+}
+
+func TestX11Wakeup(t *testing.T) {
+	wakeups := make(chan struct{})
+	_, c := newTestX11Window(t, &Options{Wakeup: wakeups})
+	wakeups <- struct{}{}
+	waitEvent(t, c, isFrameEvent)
+}
+
+func TestX11ClientMessage(t *testing.T) {
+	msgs := []ClientMessage{
+		{Window: 1, Format: 8, Bytes: [20]byte{'h', 'e', 'l', 'l', 'o'}},
+		{Window: 2, Format: 16, Shorts: [10]int16{-1, 2, 3}},
+		{Window: 3, Format: 32, Longs: [5]int64{-1, 1 << 40, 3, 4, 5}},
+	}
+	for _, msg := range msgs {
+		xev := x11ClientMessageEvent(msg)
+		got := x11ClientMessage(&xev)
+		var data, exp interface{}
+		switch msg.Format {
+		case 8:
+			data, exp = got.Bytes, msg.Bytes
+		case 16:
+			data, exp = got.Shorts, msg.Shorts
+		case 32:
+			data, exp = got.Longs, msg.Longs
+		}
+		if got.Window != msg.Window || got.Format != msg.Format || data != exp {
+			t.Errorf("format %d: got window %d, data %v, expected window %d, data %v", msg.Format, got.Window, data, msg.Window, exp)
+		}
+	}
+}
+
+func TestX11MotionButtons(t *testing.T) {
+	const (
+		button1Mask = 1 << 8
+		button2Mask = 1 << 9
+		button3Mask = 1 << 10
+	)
+	c := &testCallbacks{events: make(chan event.Event, 10)}
+	w := &x11Window{w: c}
+	h := newX11EventHandler(w)
+	h.inject(x11MotionEvent(image.Pt(10, 20), button1Mask))
+	h.handleEvents()
+	select {
+	case e := <-c.events:
+		pe, ok := e.(pointer.Event)
+		if !ok || pe.Type != pointer.Move || pe.Buttons != pointer.ButtonLeft {
+			t.Errorf("got %+v, expected a move with the left button", e)
+		}
+	default:
+		t.Fatal("no event for MotionNotify")
+	}
+	if got, exp := x11StateButtons(button2Mask|button3Mask), pointer.ButtonMiddle|pointer.ButtonRight; got != exp {
+		t.Errorf("got buttons %v, expected %v", got, exp)
+	}
+}
+
+func TestX11ClickModifiers(t *testing.T) {
+	const (
+		shiftMask   = 1 << 0
+		controlMask = 1 << 2
+	)
+	tests := []struct {
+		state uint
+		mods  key.Modifiers
+	}{
+		{0, 0},
+		{shiftMask, key.ModShift},
+		{controlMask, key.ModCtrl},
+		{shiftMask | controlMask, key.ModShift | key.ModCtrl},
+	}
+	for _, test := range tests {
+		c := &testCallbacks{events: make(chan event.Event, 10)}
+		w := &x11Window{w: c}
+		h := newX11EventHandler(w)
+		h.inject(x11ButtonEvent(true, 1, image.Pt(5, 5), time.Second, test.state))
+		h.inject(x11ButtonEvent(false, 1, image.Pt(5, 5), time.Second, test.state))
+		h.handleEvents()
+		for _, typ := range []pointer.Type{pointer.Press, pointer.Release} {
+			select {
+			case e := <-c.events:
+				pe, ok := e.(pointer.Event)
+				if !ok || pe.Type != typ || pe.Modifiers != test.mods {
+					t.Errorf("state %#x: got %+v, expected a %v with modifiers %v", test.state, e, typ, test.mods)
+				}
+			default:
+				t.Fatalf("state %#x: no %v event", test.state, typ)
+			}
+		}
+	}
+}
+
+func TestX11ErrorString(t *testing.T) {
+	err := x11Error{Code: 3, Request: 20, Resource: 0x1fffffff, Text: "BadWindow (invalid Window parameter)"}
+	const want = "x11: BadWindow (invalid Window parameter) (error 3) in request 20.0 on resource 0x1fffffff"
+	if got := err.Error(); got != want {
+		t.Errorf("got %q, expected %q", got, want)
+	}
+}
+
+func TestX11ErrorHandler(t *testing.T) {
+	if os.Getenv("DISPLAY") == "" {
+		t.Skip("no X server; run with a virtual display such as Xvfb")
+	}
+	if err := x11Init(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	// The default handler of Xlib exits the process on
+	// the BadWindow error.
+	if _, err := x11FetchTitle(0x1fffffff); err == nil {
+		t.Error("fetched the title of a missing window")
+	}
+	if !strings.Contains(buf.String(), "BadWindow") {
+		t.Errorf("got log %q, expected a BadWindow error", buf.String())
+	}
+}
+
+func TestX11AbortSelectionRequests(t *testing.T) {
+	// The event loop is held back by the unread events, so that
+	// the selection request is still pending at shutdown.
+	w, c := newTestX11Window(t, nil)
+	w.WriteClipboard("content")
+	result, err := x11RequestSelection("CLIPBOARD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.abortSelectionRequests()
+	refused, err := result(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !refused {
+		t.Error("a pending selection request was served, expected it refused")
+	}
+	w.Close()
+	waitEvent(t, c, isDestroyEvent)
+}
+
+func TestX11EventMask(t *testing.T) {
+	// The event masks of the X protocol.
+	const (
+		keyPress         = 1 << 0
+		keyRelease       = 1 << 1
+		buttonPress      = 1 << 2
+		buttonRelease    = 1 << 3
+		enterWindow      = 1 << 4
+		leaveWindow      = 1 << 5
+		pointerMotion    = 1 << 6
+		exposure         = 1 << 15
+		visibilityChange = 1 << 16
+		structureNotify  = 1 << 17
+		focusChange      = 1 << 21
+		propertyChange   = 1 << 22
+
+		base = exposure | visibilityChange | structureNotify | propertyChange
+	)
+	tests := []struct {
+		input InputMask
+		mask  int64
+	}{
+		{0, base},
+		{KeyboardInput, base | keyPress | keyRelease},
+		{ButtonInput | FocusInput, base | buttonPress | buttonRelease | focusChange},
+		{MotionInput, base | pointerMotion | enterWindow | leaveWindow},
+		{AllInput &^ MotionInput, base | keyPress | keyRelease | buttonPress | buttonRelease | focusChange},
+		{AllInput, base | keyPress | keyRelease | buttonPress | buttonRelease | pointerMotion | enterWindow | leaveWindow | focusChange},
+	}
+	for _, test := range tests {
+		if got := x11EventMask(test.input); got != test.mask {
+			t.Errorf("input %#b: got mask %#x, expected %#x", test.input, got, test.mask)
+		}
+	}
+}
+
+func TestX11PollTimeout(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tests := []struct {
+		timeout int
+		at      time.Time
+		want    int
+	}{
+		{-1, time.Time{}, -1},
+		{16, time.Time{}, 16},
+		{-1, now.Add(50 * time.Millisecond), 50},
+		{16, now.Add(50 * time.Millisecond), 16},
+		{100, now.Add(50 * time.Millisecond), 50},
+		// Partial milliseconds round up.
+		{-1, now.Add(1500 * time.Microsecond), 2},
+		// Past wakeups don't wait.
+		{-1, now.Add(-time.Second), 0},
+	}
+	for _, test := range tests {
+		if got := x11PollTimeout(test.timeout, test.at, now); got != test.want {
+			t.Errorf("x11PollTimeout(%d, %v): got %d, expected %d", test.timeout, test.at.Sub(now), got, test.want)
+		}
+	}
+}
+
+func TestX11ScheduleWakeup(t *testing.T) {
+	w, c := newTestX11Window(t, nil)
+	// Let the initial frames pass.
+	idle := time.After(200 * time.Millisecond)
+drain:
+	for {
+		select {
+		case <-c.events:
+		case <-idle:
+			break drain
+		}
+	}
+	const delay = 50 * time.Millisecond
+	start := time.Now()
+	// The later wakeup collapses into the earlier.
+	w.ScheduleWakeup(start.Add(time.Second))
+	w.ScheduleWakeup(start.Add(delay))
+	waitEvent(t, c, isFrameEvent)
+	if d := time.Since(start); d < delay {
+		t.Errorf("frame after %v, expected at least %v", d, delay)
+	} else if d >= time.Second {
+		t.Errorf("frame after %v, expected the earliest wakeup at %v", d, delay)
+	}
+}
+
+func TestX11Compositor(t *testing.T) {
+	w := new(x11Window)
+	if w.Composited() {
+		t.Fatal("composited without a selection owner")
+	}
+	// Owners of the _NET_WM_CM_Sn selection.
+	tests := []struct {
+		owner      uintptr
+		composited bool
+		changed    bool
+	}{
+		{0, false, false},
+		{0x200001, true, true},
+		{0x200001, true, false},
+		// A replaced compositing manager.
+		{0x400001, true, false},
+		{0, false, true},
+	}
+	for _, test := range tests {
+		changed := w.setCompositor(test.owner)
+		if changed != test.changed {
+			t.Errorf("owner %#x: got changed %v, expected %v", test.owner, changed, test.changed)
+		}
+		if got := w.Composited(); got != test.composited {
+			t.Errorf("owner %#x: got composited %v, expected %v", test.owner, got, test.composited)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+// +build linux,!android,!nox11 freebsd
+
+package window
+
+// This file holds the helpers of the X11 tests that need cgo, which
+// is not available in test files: constructors of synthetic events for
+// the x11EventHandler queue, and readers of the state that reached the
+// X server.
+
+/*
+#include <stdlib.h>
+#include <X11/Xlib.h>
+#include <X11/Xatom.h>
+#include <X11/Xutil.h>
+#include <X11/extensions/XInput2.h>
+*/
+import "C"
+import (
+	"errors"
+	"image"
+	"time"
+	"unsafe"
+)
+
+// inject queues a synthetic event for the next call to handleEvents.
+func (h *x11EventHandler) inject(xev C.XEvent) {
+	h.queue = append(h.queue, xev)
+}
+
+// x11KeyEvent returns a synthetic key press or release for inject.
+func x11KeyEvent(press bool, keycode int) C.XEvent {
+	var xev C.XEvent
+	kevt := (*C.XKeyEvent)(unsafe.Pointer(&xev))
+	kevt._type = C.KeyRelease
+	if press {
+		kevt._type = C.KeyPress
+	}
+	kevt.keycode = C.uint(keycode)
+	return xev
+}
+
+// x11FocusEvent returns a synthetic FocusIn or FocusOut event for inject.
+func x11FocusEvent(in bool) C.XEvent {
+	var xev C.XEvent
+	fevt := (*C.XFocusChangeEvent)(unsafe.Pointer(&xev))
+	fevt._type = C.FocusOut
+	if in {
+		fevt._type = C.FocusIn
+	}
+	fevt.mode = C.NotifyNormal
+	return xev
+}
+
+// x11ButtonEvent returns a synthetic button press or release for inject.
+func x11ButtonEvent(press bool, button int, pos image.Point, t time.Duration, state uint) C.XEvent {
+	var xev C.XEvent
+	bevt := (*C.XButtonEvent)(unsafe.Pointer(&xev))
+	bevt._type = C.ButtonRelease
+	if press {
+		bevt._type = C.ButtonPress
+	}
+	bevt.button = C.uint(button)
+	bevt.state = C.uint(state)
+	bevt.x, bevt.y = C.int(pos.X), C.int(pos.Y)
+	bevt.time = C.Time(t / time.Millisecond)
+	return xev
+}
+
+// x11MotionEvent returns a synthetic MotionNotify event for inject.
+func x11MotionEvent(pos image.Point, state uint) C.XEvent {
+	var xev C.XEvent
+	mevt := (*C.XMotionEvent)(unsafe.Pointer(&xev))
+	mevt._type = C.MotionNotify
+	mevt.x, mevt.y = C.int(pos.X), C.int(pos.Y)
+	mevt.state = C.uint(state)
+	return xev
+}
+
+// x11XIMotionEvent returns a synthetic XI_Motion event of the
+// XInput extension with opcode, for inject. The event carries the
+// values of the valuators numbered from 0, at most 8. Its data is
+// allocated by C.calloc and freed by the handler.
+func x11XIMotionEvent(opcode, device int, pos image.Point, values []float64) C.XEvent {
+	n := len(values)
+	if n > 8 {
+		panic("too many valuators")
+	}
+	// The event is followed by the values and the valuator mask.
+	data := C.calloc(1, C.sizeof_XIDeviceEvent+8*C.sizeof_double+1)
+	dev := (*C.XIDeviceEvent)(data)
+	dev._type = C.GenericEvent
+	dev.extension = C.int(opcode)
+	dev.evtype = C.XI_Motion
+	dev.deviceid, dev.sourceid = C.int(device), C.int(device)
+	dev.event_x, dev.event_y = C.double(pos.X), C.double(pos.Y)
+	vals := (*[8]C.double)(unsafe.Pointer(uintptr(data) + C.sizeof_XIDeviceEvent))
+	mask := (*C.uchar)(unsafe.Pointer(uintptr(data) + C.sizeof_XIDeviceEvent + 8*C.sizeof_double))
+	for i, v := range values {
+		vals[i] = C.double(v)
+		*mask |= 1 << uint(i)
+	}
+	dev.valuators.mask_len = 1
+	dev.valuators.mask = mask
+	dev.valuators.values = &vals[0]
+	var xev C.XEvent
+	cookie := (*C.XGenericEventCookie)(unsafe.Pointer(&xev))
+	cookie._type = C.GenericEvent
+	cookie.extension = C.int(opcode)
+	cookie.evtype = C.XI_Motion
+	cookie.data = data
+	return xev
+}
+
+// x11XIRawButtonEvent returns a synthetic XI_RawButtonPress event of
+// the XInput extension with opcode, for inject. Its data is allocated
+// by C.calloc and freed by the handler.
+func x11XIRawButtonEvent(opcode, button int, emulated bool) C.XEvent {
+	data := C.calloc(1, C.sizeof_XIRawEvent)
+	raw := (*C.XIRawEvent)(data)
+	raw._type = C.GenericEvent
+	raw.extension = C.int(opcode)
+	raw.evtype = C.XI_RawButtonPress
+	raw.detail = C.int(button)
+	if emulated {
+		raw.flags = C.XIPointerEmulated
+	}
+	var xev C.XEvent
+	cookie := (*C.XGenericEventCookie)(unsafe.Pointer(&xev))
+	cookie._type = C.GenericEvent
+	cookie.extension = C.int(opcode)
+	cookie.evtype = C.XI_RawButtonPress
+	cookie.data = data
+	return xev
+}
+
+// setScrollValuators enables the handling of the XInput events of
+// the extension with opcode, with the scroll valuators of device.
+func (w *x11Window) setScrollValuators(opcode, device int, vals []x11ScrollValuator) {
+	w.xi2.opcode = C.int(opcode)
+	w.xi2.valuators = map[C.int][]x11ScrollValuator{C.int(device): vals}
+}
+
+// x11ExposeEvent returns a synthetic Expose event for inject. Count
+// is the number of Expose events that follow.
+func x11ExposeEvent(r image.Rectangle, count int) C.XEvent {
+	var xev C.XEvent
+	eevt := (*C.XExposeEvent)(unsafe.Pointer(&xev))
+	eevt._type = C.Expose
+	eevt.x, eevt.y = C.int(r.Min.X), C.int(r.Min.Y)
+	eevt.width, eevt.height = C.int(r.Dx()), C.int(r.Dy())
+	eevt.count = C.int(count)
+	return xev
+}
+
+// x11MapEvent returns a synthetic MapNotify or UnmapNotify event
+// for inject.
+func x11MapEvent(mapped bool) C.XEvent {
+	var xev C.XEvent
+	mevt := (*C.XAnyEvent)(unsafe.Pointer(&xev))
+	mevt._type = C.UnmapNotify
+	if mapped {
+		mevt._type = C.MapNotify
+	}
+	return xev
+}
+
+// x11VisibilityEvent returns a synthetic VisibilityNotify event
+// for inject.
+func x11VisibilityEvent(obscured bool) C.XEvent {
+	var xev C.XEvent
+	vevt := (*C.XVisibilityEvent)(unsafe.Pointer(&xev))
+	vevt._type = C.VisibilityNotify
+	vevt.state = C.VisibilityUnobscured
+	if obscured {
+		vevt.state = C.VisibilityFullyObscured
+	}
+	return xev
+}
+
+// x11ConfigureEvent returns a synthetic ConfigureNotify event for inject,
+// like the events sent by window managers.
+func x11ConfigureEvent(bounds image.Rectangle) C.XEvent {
+	var xev C.XEvent
+	cevt := (*C.XConfigureEvent)(unsafe.Pointer(&xev))
+	cevt._type = C.ConfigureNotify
+	cevt.send_event = C.True
+	cevt.x, cevt.y = C.int(bounds.Min.X), C.int(bounds.Min.Y)
+	cevt.width, cevt.height = C.int(bounds.Dx()), C.int(bounds.Dy())
+	return xev
+}
+
+// x11ClientMessageEvent returns a synthetic ClientMessage event
+// with the data of msg for its format.
+func x11ClientMessageEvent(msg ClientMessage) C.XEvent {
+	var xev C.XEvent
+	cevt := (*C.XClientMessageEvent)(unsafe.Pointer(&xev))
+	cevt._type = C.ClientMessage
+	cevt.window = C.Window(msg.Window)
+	cevt.format = C.int(msg.Format)
+	switch msg.Format {
+	case 8:
+		*(*[20]byte)(unsafe.Pointer(&cevt.data)) = msg.Bytes
+	case 16:
+		*(*[10]int16)(unsafe.Pointer(&cevt.data)) = msg.Shorts
+	case 32:
+		data := (*[5]C.long)(unsafe.Pointer(&cevt.data))
+		for i, l := range msg.Longs {
+			data[i] = C.long(l)
+		}
+	}
+	return xev
+}
+
+// selfSelectionRequest returns a request from the window to itself
+// for the content of the CLIPBOARD or PRIMARY selection in the named
+// target.
+func (w *x11Window) selfSelectionRequest(primary bool, target string) C.XSelectionRequestEvent {
+	req := C.XSelectionRequestEvent{
+		_type:     C.SelectionRequest,
+		display:   w.x,
+		owner:     w.xw,
+		requestor: w.xw,
+		selection: w.atoms.clipboard,
+		target:    w.atom(target, false),
+		property:  w.atoms.clipboardContent,
+		time:      C.CurrentTime,
+	}
+	if primary {
+		req.selection = C.XA_PRIMARY
+		req.property = w.atoms.primaryContent
+	}
+	return req
+}
+
+// selectionClearEvent returns the event sent when another client
+// takes ownership of the CLIPBOARD or PRIMARY selection.
+func (w *x11Window) selectionClearEvent(primary bool) C.XEvent {
+	var xev C.XEvent
+	cevt := (*C.XSelectionClearEvent)(unsafe.Pointer(&xev))
+	cevt._type = C.SelectionClear
+	cevt.window = w.xw
+	cevt.selection = w.atoms.clipboard
+	if primary {
+		cevt.selection = C.XA_PRIMARY
+	}
+	return xev
+}
+
+// role returns the WM_WINDOW_ROLE property.
+func (w *x11Window) role() string {
+	var (
+		typ        C.Atom
+		format     C.int
+		nitems     C.ulong
+		bytesAfter C.ulong
+		data       *C.uchar
+	)
+	if C.XGetWindowProperty(w.x, w.xw, w.atom("WM_WINDOW_ROLE", false), 0, 1024, C.False, C.XA_STRING,
+		&typ, &format, &nitems, &bytesAfter, &data) != C.Success || data == nil {
+		return ""
+	}
+	defer C.XFree(unsafe.Pointer(data))
+	if format != 8 {
+		return ""
+	}
+	return C.GoStringN((*C.char)(unsafe.Pointer(data)), C.int(nitems))
+}
+
+// processHints returns the properties set by setProcessHints.
+func (w *x11Window) processHints() (pid int, host string) {
+	if pids := w.readLongs(w.xw, w.atom("_NET_WM_PID", false), C.XA_CARDINAL); len(pids) == 1 {
+		pid = int(pids[0])
+	}
+	var prop C.XTextProperty
+	if C.XGetWMClientMachine(w.x, w.xw, &prop) != 0 {
+		defer C.XFree(unsafe.Pointer(prop.value))
+		if prop.format == 8 {
+			host = C.GoStringN((*C.char)(unsafe.Pointer(prop.value)), C.int(prop.nitems))
+		}
+	}
+	return pid, host
+}
+
+// x11FetchTitle reads the title of a window through a new
+// connection to the default display, to observe the requests
+// that reached the server.
+func x11FetchTitle(win uintptr) (string, error) {
+	dpy := C.XOpenDisplay(nil)
+	if dpy == nil {
+		return "", errors.New("x11: failed to open display")
+	}
+	defer C.XCloseDisplay(dpy)
+	var name *C.char
+	if C.XFetchName(dpy, C.Window(win), &name) == 0 || name == nil {
+		return "", errors.New("x11: window has no name")
+	}
+	defer C.XFree(unsafe.Pointer(name))
+	return C.GoString(name), nil
+}
+
+// x11RequestSelection converts a selection to text through a new
+// connection to the default display. The returned function waits
+// for the answer and reports whether the owner refused the request.
+func x11RequestSelection(selection string) (func(timeout time.Duration) (bool, error), error) {
+	dpy := C.XOpenDisplay(nil)
+	if dpy == nil {
+		return nil, errors.New("x11: failed to open display")
+	}
+	win := C.XCreateSimpleWindow(dpy, C.XDefaultRootWindow(dpy), 0, 0, 1, 1, 0, 0, 0)
+	atom := func(name string) C.Atom {
+		cname := C.CString(name)
+		defer C.free(unsafe.Pointer(cname))
+		return C.XInternAtom(dpy, cname, C.False)
+	}
+	C.XConvertSelection(dpy, atom(selection), atom("UTF8_STRING"), atom("GIO_SELECTION"), win, C.CurrentTime)
+	// Make sure the server has forwarded the request to the owner.
+	C.XSync(dpy, C.False)
+	return func(timeout time.Duration) (bool, error) {
+		defer C.XCloseDisplay(dpy)
+		deadline := time.Now().Add(timeout)
+		var xev C.XEvent
+		for C.XCheckTypedWindowEvent(dpy, win, C.SelectionNotify, &xev) == 0 {
+			if time.Now().After(deadline) {
+				return false, errors.New("x11: timeout waiting for SelectionNotify")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		notify := (*C.XSelectionEvent)(unsafe.Pointer(&xev))
+		return notify.property == C.None, nil
+	}, nil
+}
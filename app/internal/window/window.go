@@ -5,19 +5,114 @@
 package window
 
 import (
+	// Renamed to not clash with the context types of the
+	// platform GPU contexts.
+	gocontext "context"
 	"errors"
+	"image"
+	"image/color"
 	"math"
 	"time"
+	"unsafe"
 
 	"gioui.org/app/internal/gl"
 	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
 	"gioui.org/io/system"
 	"gioui.org/unit"
 )
 
 type Options struct {
 	Width, Height unit.Value
-	Title         string
+	// MinWidth, MinHeight, MaxWidth and MaxHeight constrain
+	// the window size. Zero values are ignored.
+	MinWidth, MinHeight unit.Value
+	MaxWidth, MaxHeight unit.Value
+	Title               string
+	// Class is the class of the window, used by X11 window
+	// managers for window rules. The empty class means the
+	// program name.
+	Class string
+	// Role identifies the window among the windows of the
+	// program, for X11 session managers to restore it.
+	Role string
+	// Pos is the initial position of the window in pixels,
+	// relative to the screen. The zero value leaves the
+	// placement to the window manager.
+	Pos image.Point
+	// Centered centers the window on the screen. It
+	// overrides Pos.
+	Centered bool
+	// Icon is the window icon in one or more sizes.
+	Icon []image.Image
+	// Resizable allows the user to resize the window.
+	Resizable bool
+	// Decorated shows the title bar and borders of the
+	// window manager.
+	Decorated bool
+	// Focused requests keyboard focus for the new window.
+	Focused bool
+	// Fullscreen requests an initially fullscreen window.
+	Fullscreen bool
+	// Maximized requests an initially maximized window.
+	Maximized bool
+	// AlwaysOnTop requests a window that is kept above
+	// other windows.
+	AlwaysOnTop bool
+	// Opacity is the opacity of the window, from 0 for a
+	// transparent window to 1 for an opaque window.
+	Opacity float32
+	// BackgroundColor is shown before the first frame is
+	// drawn. Its alpha is ignored, except that a transparent
+	// color leaves the content undefined.
+	BackgroundColor color.NRGBA
+	// Display is the name of the X11 display to connect
+	// to. The empty name means the DISPLAY environment
+	// variable.
+	Display string
+	// Screen is the X11 screen of the window, or -1 for
+	// the screen of the display name.
+	Screen int
+	// Type is the X11 window type, the suffix of a
+	// _NET_WM_WINDOW_TYPE atom such as DIALOG. The empty
+	// type means a normal window.
+	Type string
+	// TransientFor is the X11 window the window is a dialog
+	// or tool window of. Zero means none.
+	TransientFor uintptr
+	// Embed is the X11 window to embed the window in through
+	// the XEmbed protocol. Zero means a standalone window.
+	Embed uintptr
+	// ClientMessage, if set, receives the X11 client messages
+	// not handled by the window.
+	ClientMessage func(msg ClientMessage)
+	// Headless creates the window without showing it, for
+	// testing the event loop against a virtual display such
+	// as Xvfb. It is only supported on X11.
+	Headless bool
+	// ScrollScale is the scroll distance in pixels of a
+	// mouse wheel step. Zero means the platform default.
+	ScrollScale float32
+	// CoalesceEdits merges the key.EditEvents that arrive
+	// before a frame.
+	CoalesceEdits bool
+	// MaxFPS limits the rate of frames that are not required
+	// by the system, such as frames of animations. Zero means
+	// no limit.
+	MaxFPS int
+	// Wakeup requests a frame for every value received
+	// from it.
+	Wakeup <-chan struct{}
+	// FontScale scales text relative to the rest of the user
+	// interface. Zero means the platform default.
+	FontScale float32
+	// ClickInterval is the maximum time between the presses of
+	// a double click. Zero means the platform default.
+	ClickInterval time.Duration
+	// DisabledInput is the set of input categories the window
+	// doesn't receive. The zero value enables all input.
+	DisabledInput InputMask
 }
 
 type FrameEvent struct {
@@ -26,6 +121,69 @@ type FrameEvent struct {
 	Sync bool
 }
 
+// MaximizeEvent is sent when the maximized state of the
+// window changes.
+type MaximizeEvent struct {
+	Maximized bool
+}
+
+// ClientMessage is an X11 client message. The data is a union
+// of 20 bytes, 10 shorts or 5 longs, depending on the format.
+type ClientMessage struct {
+	// Window is the window the message is about.
+	Window uintptr
+	// Type is the name of the message type atom.
+	Type string
+	// Format is the size in bits of the data items:
+	// 8, 16 or 32.
+	Format int
+	// Bytes is the data of format 8 messages.
+	Bytes [20]byte
+	// Shorts is the data of format 16 messages.
+	Shorts [10]int16
+	// Longs is the data of format 32 messages.
+	Longs [5]int64
+}
+
+// InputMask is a set of input categories.
+type InputMask uint8
+
+const (
+	// KeyboardInput is key presses and releases.
+	KeyboardInput InputMask = 1 << iota
+	// ButtonInput is pointer button presses and releases,
+	// including scrolling and touches.
+	ButtonInput
+	// MotionInput is pointer motion and crossing.
+	MotionInput
+	// FocusInput is changes of the keyboard focus.
+	FocusInput
+
+	AllInput = KeyboardInput | ButtonInput | MotionInput | FocusInput
+)
+
+// FrameExtentsEvent is sent when the size of the decorations
+// around the window changes.
+type FrameExtentsEvent struct {
+	// Left, Right, Top and Bottom are the widths of the
+	// decorations in pixels.
+	Left, Right, Top, Bottom int
+}
+
+// BoundsEvent is sent when the window moves or changes
+// size.
+type BoundsEvent struct {
+	// Bounds is the window rectangle including the
+	// decorations, in screen pixels.
+	Bounds image.Rectangle
+}
+
+// AlwaysOnTopEvent is sent when the window manager keeps
+// the window above other windows, or stops doing so.
+type AlwaysOnTopEvent struct {
+	AlwaysOnTop bool
+}
+
 type Callbacks interface {
 	SetDriver(d Driver)
 	Event(e event.Event)
@@ -48,9 +206,236 @@ type Driver interface {
 	SetAnimating(anim bool)
 	// ShowTextInput updates the virtual keyboard state.
 	ShowTextInput(show bool)
+	// SetTitle updates the window title.
+	SetTitle(title string)
 	NewContext() (Context, error)
 }
 
+// ClipboardDriver is implemented by drivers with
+// access to the system clipboard.
+type ClipboardDriver interface {
+	// ReadClipboard requests the clipboard content, to be
+	// delivered as a system.ClipboardEvent.
+	ReadClipboard()
+	// WriteClipboard replaces the clipboard content.
+	WriteClipboard(s string)
+}
+
+// MIMEClipboardDriver is implemented by drivers that
+// support clipboard content of any MIME type.
+type MIMEClipboardDriver interface {
+	// ReadClipboardMIME requests the clipboard content of
+	// a type, to be delivered as a system.ClipboardEvent.
+	ReadClipboardMIME(mime string)
+	// WriteClipboardMIME replaces the clipboard content
+	// with data of a type.
+	WriteClipboardMIME(mime string, data []byte)
+}
+
+// ContextClipboardDriver is implemented by drivers that
+// can abandon clipboard reads.
+type ContextClipboardDriver interface {
+	// ReadClipboardContext is like ReadClipboardMIME, except
+	// that the read fails with the error of ctx when it is
+	// done before the content arrives.
+	ReadClipboardContext(ctx gocontext.Context, mime string)
+}
+
+// PrimarySelectionDriver is implemented by drivers
+// with a primary selection, such as X11.
+type PrimarySelectionDriver interface {
+	// SetPrimarySelection replaces the content of the
+	// primary selection.
+	SetPrimarySelection(s string)
+}
+
+// InvalidateDriver is implemented by drivers that can
+// draw a single frame on request.
+type InvalidateDriver interface {
+	// Invalidate requests a FrameEvent. It is safe for
+	// concurrent use.
+	Invalidate()
+}
+
+// CompositorDriver is implemented by drivers that can tell
+// whether a compositing manager is running. Changes are sent
+// as system.CompositorEvents.
+type CompositorDriver interface {
+	// Composited reports whether a compositing manager is
+	// running. It is safe for concurrent use.
+	Composited() bool
+}
+
+// WakeupDriver is implemented by drivers that can
+// draw a single frame at a later time.
+type WakeupDriver interface {
+	// ScheduleWakeup requests a FrameEvent at the time at.
+	// Only the earliest of the pending wakeups is kept. It
+	// is safe for concurrent use.
+	ScheduleWakeup(at time.Time)
+}
+
+// CloseDriver is implemented by drivers
+// that can close their window.
+type CloseDriver interface {
+	// Close the window.
+	Close()
+}
+
+// SizeDriver is implemented by drivers
+// that can resize their window.
+type SizeDriver interface {
+	// SetSize requests a new window size.
+	SetSize(width, height unit.Value)
+}
+
+// SizeHintsDriver is implemented by drivers that
+// can constrain the size of their window.
+type SizeHintsDriver interface {
+	// SetMinMaxSize sets the size constraints of the
+	// window. Zero values are ignored.
+	SetMinMaxSize(minWidth, minHeight, maxWidth, maxHeight unit.Value)
+}
+
+// IconDriver is implemented by drivers
+// that can set the window icon.
+type IconDriver interface {
+	// SetIcon sets the window icon in one or
+	// more sizes.
+	SetIcon(icon []image.Image)
+}
+
+// PosDriver is implemented by drivers
+// that can move windows.
+type PosDriver interface {
+	// SetPos requests a new window position in pixels.
+	SetPos(x, y int)
+}
+
+// FullscreenDriver is implemented by drivers
+// that can switch windows to and from fullscreen.
+type FullscreenDriver interface {
+	// SetFullscreen enters or leaves fullscreen.
+	SetFullscreen(fullscreen bool)
+}
+
+// CursorDriver is implemented by drivers
+// that can change the mouse cursor.
+type CursorDriver interface {
+	// SetCursor sets the cursor shown over the window.
+	SetCursor(name pointer.CursorName)
+}
+
+// MaximizeDriver is implemented by drivers
+// that can maximize windows.
+type MaximizeDriver interface {
+	// SetMaximized maximizes or restores the window.
+	SetMaximized(maximized bool)
+}
+
+// IconifyDriver is implemented by drivers
+// that can minimize windows.
+type IconifyDriver interface {
+	// Iconify minimizes the window.
+	Iconify()
+}
+
+// AlwaysOnTopDriver is implemented by drivers
+// that can keep windows above other windows.
+type AlwaysOnTopDriver interface {
+	// SetAlwaysOnTop keeps the window above other windows
+	// or restores its normal stacking.
+	SetAlwaysOnTop(on bool)
+}
+
+// TypeDriver is implemented by drivers that support
+// window types.
+type TypeDriver interface {
+	// SetType sets the window type, in the form of
+	// Options.Type.
+	SetType(typ string)
+}
+
+// TransientDriver is implemented by drivers that
+// support transient windows.
+type TransientDriver interface {
+	// SetTransientFor marks the window as transient for
+	// the native window parent, or clears the mark if
+	// parent is zero.
+	SetTransientFor(parent uintptr)
+}
+
+// UrgentDriver is implemented by drivers that can
+// request the attention of the user.
+type UrgentDriver interface {
+	// SetUrgent sets or clears the urgency of the window.
+	SetUrgent(urgent bool)
+}
+
+// DecorationDriver is implemented by drivers that can
+// remove the window decorations.
+type DecorationDriver interface {
+	// SetDecorated shows or hides the title bar and borders.
+	SetDecorated(decorated bool)
+}
+
+// MoveResizeDriver is implemented by drivers that let the
+// user move and resize windows from a custom title bar.
+// Both methods must be called while a pointer button is
+// pressed.
+type MoveResizeDriver interface {
+	// Move starts an interactive move of the window.
+	Move()
+	// Resize starts an interactive resize of the window
+	// edge or corner.
+	Resize(edge pointer.Edge)
+}
+
+// PointerGrabDriver is implemented by drivers that can
+// grab the pointer.
+type PointerGrabDriver interface {
+	// GrabPointer delivers all pointer events to the window
+	// until ReleasePointer is called.
+	GrabPointer()
+	// ReleasePointer releases a pointer grab.
+	ReleasePointer()
+}
+
+// KeyboardGrabDriver is implemented by drivers that can
+// grab the keyboard.
+type KeyboardGrabDriver interface {
+	// GrabKeyboard delivers all key events to the window
+	// until ReleaseKeyboard is called.
+	GrabKeyboard()
+	// ReleaseKeyboard releases a keyboard grab.
+	ReleaseKeyboard()
+}
+
+// HotkeyDriver is implemented by drivers that support
+// global hotkeys.
+type HotkeyDriver interface {
+	// RegisterHotkey reports presses of the key with the
+	// keysym name sym and modifiers as system.HotkeyEvents.
+	RegisterHotkey(sym string, mods key.Modifiers)
+	// UnregisterHotkey removes a registered hotkey.
+	UnregisterHotkey(sym string, mods key.Modifiers)
+}
+
+// NativeDriver is implemented by drivers that expose
+// their native window handles.
+type NativeDriver interface {
+	// NativeWindow returns the native display connection
+	// and window handle.
+	NativeWindow() (display unsafe.Pointer, window uintptr)
+}
+
+// OpacityDriver is implemented by drivers
+// that support translucent windows.
+type OpacityDriver interface {
+	// SetOpacity sets the window opacity between 0 and 1.
+	SetOpacity(opacity float32)
+}
+
 type windowRendezvous struct {
 	in   chan windowAndOptions
 	out  chan windowAndOptions
@@ -69,6 +454,17 @@ type config struct {
 	// Device pixels per sp.
 	pxPerSp float32
 	now     time.Time
+	// scrollScale is the scroll distance in pixels of
+	// a wheel step.
+	scrollScale float32
+	// refreshRate is the display refresh rate in Hz,
+	// or 0 if unknown.
+	refreshRate float32
+}
+
+// RefreshRate implements system.RefreshRateConfig.
+func (c *config) RefreshRate() float32 {
+	return c.refreshRate
 }
 
 func (c *config) Now() time.Time {
@@ -115,3 +511,8 @@ func newWindowRendezvous() *windowRendezvous {
 	}()
 	return wr
 }
+
+func (MaximizeEvent) ImplementsEvent()     {}
+func (AlwaysOnTopEvent) ImplementsEvent()  {}
+func (FrameExtentsEvent) ImplementsEvent() {}
+func (BoundsEvent) ImplementsEvent()       {}
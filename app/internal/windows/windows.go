@@ -7,6 +7,7 @@ package windows
 import (
 	"fmt"
 	"runtime"
+	"strings"
 	"time"
 	"unsafe"
 
@@ -83,6 +84,7 @@ const (
 	VK_END    = 0x23
 	VK_ESCAPE = 0x1b
 	VK_HOME   = 0x24
+	VK_INSERT = 0x2d
 	VK_LEFT   = 0x25
 	VK_NEXT   = 0x22
 	VK_PRIOR  = 0x21
@@ -206,6 +208,7 @@ var (
 	_SetFocus                    = user32.NewProc("SetFocus")
 	_SetProcessDPIAware          = user32.NewProc("SetProcessDPIAware")
 	_SetTimer                    = user32.NewProc("SetTimer")
+	_SetWindowText               = user32.NewProc("SetWindowTextW")
 	_TranslateMessage            = user32.NewProc("TranslateMessage")
 	_UnregisterClass             = user32.NewProc("UnregisterClassW")
 	_UpdateWindow                = user32.NewProc("UpdateWindow")
@@ -404,6 +407,16 @@ func SetFocus(hwnd syscall.Handle) {
 	_SetFocus.Call(uintptr(hwnd))
 }
 
+// SetWindowText sets the title of a window. A title with a NUL
+// character is truncated before it.
+func SetWindowText(hwnd syscall.Handle, title string) {
+	wname, err := syscall.UTF16PtrFromString(title)
+	if err != nil {
+		wname, _ = syscall.UTF16PtrFromString(title[:strings.IndexByte(title, 0)])
+	}
+	_SetWindowText.Call(uintptr(hwnd), uintptr(unsafe.Pointer(wname)))
+}
+
 func SetProcessDPIAware() {
 	_SetProcessDPIAware.Call()
 }
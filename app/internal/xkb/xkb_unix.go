@@ -133,7 +133,34 @@ func (x *Context) LoadKeymap(format int, fd int, size int) error {
 	return nil
 }
 
-func (x *Context) DispatchKey(keyCode uint32) (events []event.Event) {
+// loadTestKeymap loads a keymap of the evdev rules. It is
+// for tests, because cgo is not available in test files.
+func (x *Context) loadTestKeymap(layout, variant string) error {
+	crules, clayout, cvariant := C.CString("evdev"), C.CString(layout), C.CString(variant)
+	defer C.free(unsafe.Pointer(crules))
+	defer C.free(unsafe.Pointer(clayout))
+	defer C.free(unsafe.Pointer(cvariant))
+	names := C.struct_xkb_rule_names{rules: crules, layout: clayout, variant: cvariant}
+	keyMap := C.xkb_keymap_new_from_names(x.Ctx, &names, C.XKB_KEYMAP_COMPILE_NO_FLAGS)
+	if keyMap == nil {
+		return errors.New("xkb: xkb_keymap_new_from_names failed")
+	}
+	state := C.xkb_state_new(keyMap)
+	if state == nil {
+		C.xkb_keymap_unref(keyMap)
+		return errors.New("xkb: xkb_state_new failed")
+	}
+	x.SetKeymap(unsafe.Pointer(keyMap), unsafe.Pointer(state))
+	return nil
+}
+
+// evdevOffset is the difference between XKB keycodes and the
+// Linux evdev codes they are based on.
+const evdevOffset = 8
+
+// DispatchKey returns the events for a key press or release. Text is
+// only reported for presses.
+func (x *Context) DispatchKey(keyCode uint32, state key.State) (events []event.Event) {
 	if x.state == nil {
 		return
 	}
@@ -142,14 +169,20 @@ func (x *Context) DispatchKey(keyCode uint32) (events []event.Event) {
 		x.utf8Buf = make([]byte, 1)
 	}
 	sym := C.xkb_state_key_get_one_sym(x.state, kc)
-	if name, ok := convertKeysym(sym); ok {
-		cmd := key.Event{Name: name}
+	ctrl := C.xkb_state_mod_name_is_active(x.state, (*C.char)(unsafe.Pointer(&_XKB_MOD_NAME_CTRL[0])), C.XKB_STATE_MODS_EFFECTIVE) == 1
+	name, ok := convertKeysym(sym)
+	if !ok && reportSym(sym) {
+		// Report keys without a name by their keysym name.
+		ok = true
+	}
+	if ok {
+		cmd := key.Event{Name: name, Sym: keysymName(sym), ScanCode: keyCode - evdevOffset, State: state}
 		// Ensure that a physical backtab key is translated to
 		// Shift-Tab.
 		if sym == C.XKB_KEY_ISO_Left_Tab {
 			cmd.Modifiers |= key.ModShift
 		}
-		if C.xkb_state_mod_name_is_active(x.state, (*C.char)(unsafe.Pointer(&_XKB_MOD_NAME_CTRL[0])), C.XKB_STATE_MODS_EFFECTIVE) == 1 {
+		if ctrl {
 			cmd.Modifiers |= key.ModCtrl
 		}
 		if C.xkb_state_mod_name_is_active(x.state, (*C.char)(unsafe.Pointer(&_XKB_MOD_NAME_SHIFT[0])), C.XKB_STATE_MODS_EFFECTIVE) == 1 {
@@ -161,8 +194,20 @@ func (x *Context) DispatchKey(keyCode uint32) (events []event.Event) {
 		if C.xkb_state_mod_name_is_active(x.state, (*C.char)(unsafe.Pointer(&_XKB_MOD_NAME_LOGO[0])), C.XKB_STATE_MODS_EFFECTIVE) == 1 {
 			cmd.Modifiers |= key.ModSuper
 		}
+		// The state is updated after the key event, so include
+		// the effect of a modifier key here.
+		if mod, ok := modifierForKeysym(sym); ok {
+			if state == key.Press {
+				cmd.Modifiers |= mod
+			} else {
+				cmd.Modifiers &^= mod
+			}
+		}
 		events = append(events, cmd)
 	}
+	if state == key.Release {
+		return
+	}
 	C.xkb_compose_state_feed(x.compState, sym)
 	var str []byte
 	switch C.xkb_compose_state_get_status(x.compState) {
@@ -190,12 +235,56 @@ func (x *Context) DispatchKey(keyCode uint32) (events []event.Event) {
 			str = str[:len(str)-s]
 		}
 	}
-	if len(str) > 0 {
+	// Keys pressed with Ctrl are commands, not text.
+	if len(str) > 0 && !ctrl {
 		events = append(events, key.EditEvent{Text: string(str)})
 	}
 	return
 }
 
+// modifierForKeysym returns the modifier of a modifier key.
+func modifierForKeysym(s keysym) (key.Modifiers, bool) {
+	switch s {
+	case C.XKB_KEY_Shift_L, C.XKB_KEY_Shift_R:
+		return key.ModShift, true
+	case C.XKB_KEY_Control_L, C.XKB_KEY_Control_R:
+		return key.ModCtrl, true
+	case C.XKB_KEY_Alt_L, C.XKB_KEY_Alt_R:
+		return key.ModAlt, true
+	case C.XKB_KEY_Super_L, C.XKB_KEY_Super_R:
+		return key.ModSuper, true
+	}
+	return 0, false
+}
+
+// keysymName returns the name of a keysym, such as "XF86AudioPlay".
+func keysymName(sym keysym) string {
+	var buf [64]C.char
+	n := C.xkb_keysym_get_name(sym, &buf[0], C.size_t(len(buf)))
+	if n <= 0 {
+		return ""
+	}
+	return C.GoString(&buf[0])
+}
+
+// reportSym reports whether a key without a name is reported by its
+// keysym name. Dead keys and the modifiers without a name are not
+// reported, because they only affect the following keys.
+func reportSym(s keysym) bool {
+	switch {
+	case s == C.XKB_KEY_NoSymbol:
+		return false
+	case 0xfe00 <= s && s <= 0xfeff:
+		// ISO modifiers and dead keys.
+		return false
+	case C.XKB_KEY_Shift_L <= s && s <= C.XKB_KEY_Hyper_R:
+		return false
+	case s == C.XKB_KEY_Mode_switch || s == C.XKB_KEY_Num_Lock:
+		return false
+	}
+	return true
+}
+
 func (x *Context) charsForKeycode(keyCode C.xkb_keycode_t) []byte {
 	size := C.xkb_state_key_get_utf8(x.state, keyCode, (*C.char)(unsafe.Pointer(&x.utf8Buf[0])), C.size_t(len(x.utf8Buf)))
 	if int(size) >= len(x.utf8Buf) {
@@ -218,71 +307,112 @@ func (x *Context) UpdateMask(depressed, latched, locked, depressedGroup, latched
 		C.xkb_layout_index_t(depressedGroup), C.xkb_layout_index_t(latchedGroup), C.xkb_layout_index_t(lockedGroup))
 }
 
-func convertKeysym(s C.xkb_keysym_t) (string, bool) {
+// keysym is an xkb keysym value.
+type keysym = C.xkb_keysym_t
+
+func convertKeysym(s keysym) (string, bool) {
 	if 'a' <= s && s <= 'z' {
 		return string(s - 'a' + 'A'), true
 	}
+	if s == C.XKB_KEY_space {
+		return key.NameSpace, true
+	}
 	if ' ' <= s && s <= '~' {
 		return string(s), true
 	}
+	// Keypad digits, reported while NumLock is on.
+	if C.XKB_KEY_KP_0 <= s && s <= C.XKB_KEY_KP_9 {
+		return string(s - C.XKB_KEY_KP_0 + '0'), true
+	}
 	var n string
 	switch s {
 	case C.XKB_KEY_Escape:
 		n = key.NameEscape
-	case C.XKB_KEY_Left:
+	case C.XKB_KEY_Left, C.XKB_KEY_KP_Left:
 		n = key.NameLeftArrow
-	case C.XKB_KEY_Right:
+	case C.XKB_KEY_Right, C.XKB_KEY_KP_Right:
 		n = key.NameRightArrow
 	case C.XKB_KEY_Return:
 		n = key.NameReturn
 	case C.XKB_KEY_KP_Enter:
 		n = key.NameEnter
-	case C.XKB_KEY_Up:
+	case C.XKB_KEY_Up, C.XKB_KEY_KP_Up:
 		n = key.NameUpArrow
-	case C.XKB_KEY_Down:
+	case C.XKB_KEY_Down, C.XKB_KEY_KP_Down:
 		n = key.NameDownArrow
-	case C.XKB_KEY_Home:
+	case C.XKB_KEY_Home, C.XKB_KEY_KP_Home:
 		n = key.NameHome
-	case C.XKB_KEY_End:
+	case C.XKB_KEY_End, C.XKB_KEY_KP_End:
 		n = key.NameEnd
 	case C.XKB_KEY_BackSpace:
 		n = key.NameDeleteBackward
-	case C.XKB_KEY_Delete:
+	case C.XKB_KEY_Delete, C.XKB_KEY_KP_Delete:
 		n = key.NameDeleteForward
-	case C.XKB_KEY_Page_Up:
+	case C.XKB_KEY_Insert, C.XKB_KEY_KP_Insert:
+		n = key.NameInsert
+	case C.XKB_KEY_Page_Up, C.XKB_KEY_KP_Page_Up:
 		n = key.NamePageUp
-	case C.XKB_KEY_Page_Down:
+	case C.XKB_KEY_Page_Down, C.XKB_KEY_KP_Page_Down:
 		n = key.NamePageDown
 	case C.XKB_KEY_F1:
-		n = "F1"
+		n = key.NameF1
 	case C.XKB_KEY_F2:
-		n = "F2"
+		n = key.NameF2
 	case C.XKB_KEY_F3:
-		n = "F3"
+		n = key.NameF3
 	case C.XKB_KEY_F4:
-		n = "F4"
+		n = key.NameF4
 	case C.XKB_KEY_F5:
-		n = "F5"
+		n = key.NameF5
 	case C.XKB_KEY_F6:
-		n = "F6"
+		n = key.NameF6
 	case C.XKB_KEY_F7:
-		n = "F7"
+		n = key.NameF7
 	case C.XKB_KEY_F8:
-		n = "F8"
+		n = key.NameF8
 	case C.XKB_KEY_F9:
-		n = "F9"
+		n = key.NameF9
 	case C.XKB_KEY_F10:
-		n = "F10"
+		n = key.NameF10
 	case C.XKB_KEY_F11:
-		n = "F11"
+		n = key.NameF11
 	case C.XKB_KEY_F12:
-		n = "F12"
+		n = key.NameF12
 	case C.XKB_KEY_Tab, C.XKB_KEY_KP_Tab, C.XKB_KEY_ISO_Left_Tab:
 		n = key.NameTab
-	case 0x20, C.XKB_KEY_KP_Space:
-		n = "Space"
+	case C.XKB_KEY_KP_Space:
+		n = key.NameSpace
+	case C.XKB_KEY_Shift_L, C.XKB_KEY_Shift_R:
+		n = key.NameShift
+	case C.XKB_KEY_Control_L, C.XKB_KEY_Control_R:
+		n = key.NameCtrl
+	case C.XKB_KEY_Alt_L, C.XKB_KEY_Alt_R:
+		n = key.NameAlt
+	case C.XKB_KEY_Super_L, C.XKB_KEY_Super_R:
+		n = key.NameSuper
 	default:
-		return "", false
+		n, ok := xf86Names[s]
+		return n, ok
 	}
 	return n, true
 }
+
+// xf86Names maps the XF86 keysyms of media and browser keys
+// to key names.
+var xf86Names = map[keysym]string{
+	C.XKB_KEY_XF86AudioPlay:         key.NameMediaPlayPause,
+	C.XKB_KEY_XF86AudioPause:        key.NameMediaPlayPause,
+	C.XKB_KEY_XF86AudioStop:         key.NameMediaStop,
+	C.XKB_KEY_XF86AudioNext:         key.NameMediaNext,
+	C.XKB_KEY_XF86AudioPrev:         key.NameMediaPrevious,
+	C.XKB_KEY_XF86AudioRaiseVolume:  key.NameVolumeUp,
+	C.XKB_KEY_XF86AudioLowerVolume:  key.NameVolumeDown,
+	C.XKB_KEY_XF86AudioMute:         key.NameVolumeMute,
+	C.XKB_KEY_XF86MonBrightnessUp:   key.NameBrightnessUp,
+	C.XKB_KEY_XF86MonBrightnessDown: key.NameBrightnessDown,
+	C.XKB_KEY_XF86Back:              key.NameBrowserBack,
+	C.XKB_KEY_XF86Forward:           key.NameBrowserForward,
+	C.XKB_KEY_XF86Reload:            key.NameBrowserRefresh,
+	C.XKB_KEY_XF86HomePage:          key.NameBrowserHome,
+	C.XKB_KEY_XF86Search:            key.NameBrowserSearch,
+}
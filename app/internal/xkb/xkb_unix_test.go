@@ -0,0 +1,249 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+// +build linux,!android freebsd
+// +build cgo
+
+package xkb
+
+import (
+	"reflect"
+	"testing"
+
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+)
+
+func TestConvertKeypadKeysym(t *testing.T) {
+	tests := []struct {
+		sym  uint32
+		name string
+	}{
+		// NumLock on.
+		{0xffb0, "0"}, // XKB_KEY_KP_0
+		{0xffb5, "5"}, // XKB_KEY_KP_5
+		{0xffb9, "9"}, // XKB_KEY_KP_9
+		// NumLock off.
+		{0xff95, key.NameHome},          // XKB_KEY_KP_Home
+		{0xff9c, key.NameEnd},           // XKB_KEY_KP_End
+		{0xff96, key.NameLeftArrow},     // XKB_KEY_KP_Left
+		{0xff9b, key.NamePageDown},      // XKB_KEY_KP_Page_Down
+		{0xff9f, key.NameDeleteForward}, // XKB_KEY_KP_Delete
+	}
+	for _, test := range tests {
+		name, ok := convertKeysym(keysym(test.sym))
+		if !ok || name != test.name {
+			t.Errorf("keysym %#x: got %q, %v, expected %q", test.sym, name, ok, test.name)
+		}
+	}
+}
+
+func TestConvertXF86Keysym(t *testing.T) {
+	tests := []struct {
+		sym  uint32
+		name string
+	}{
+		{0x1008ff14, key.NameMediaPlayPause}, // XKB_KEY_XF86AudioPlay
+		{0x1008ff13, key.NameVolumeUp},       // XKB_KEY_XF86AudioRaiseVolume
+		{0x1008ff02, key.NameBrightnessUp},   // XKB_KEY_XF86MonBrightnessUp
+		{0x1008ff26, key.NameBrowserBack},    // XKB_KEY_XF86Back
+	}
+	for _, test := range tests {
+		name, ok := convertKeysym(keysym(test.sym))
+		if !ok || name != test.name {
+			t.Errorf("keysym %#x: got %q, %v, expected %q", test.sym, name, ok, test.name)
+		}
+	}
+}
+
+// newTestContext returns a context with a keymap of the evdev rules,
+// or skips the test if it can't be loaded.
+func newTestContext(t *testing.T, layout, variant string) *Context {
+	t.Helper()
+	ctx, err := New()
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(ctx.Destroy)
+	if err := ctx.loadTestKeymap(layout, variant); err != nil {
+		t.Skip(err)
+	}
+	return ctx
+}
+
+func TestDispatchKeyRelease(t *testing.T) {
+	ctx := newTestContext(t, "us", "")
+	// Keycodes of the evdev rules.
+	const (
+		keyA      = 38
+		keyEscape = 9
+	)
+	tests := []struct {
+		code    uint32
+		press   []event.Event
+		release []event.Event
+	}{
+		{
+			keyA,
+			[]event.Event{key.Event{Name: "A", Sym: "a", ScanCode: keyA - 8}, key.EditEvent{Text: "a"}},
+			[]event.Event{key.Event{Name: "A", Sym: "a", ScanCode: keyA - 8, State: key.Release}},
+		},
+		{
+			keyEscape,
+			[]event.Event{key.Event{Name: key.NameEscape, Sym: "Escape", ScanCode: keyEscape - 8}},
+			[]event.Event{key.Event{Name: key.NameEscape, Sym: "Escape", ScanCode: keyEscape - 8, State: key.Release}},
+		},
+	}
+	for _, test := range tests {
+		if got := ctx.DispatchKey(test.code, key.Press); !reflect.DeepEqual(got, test.press) {
+			t.Errorf("keycode %d press: got %v, expected %v", test.code, got, test.press)
+		}
+		if got := ctx.DispatchKey(test.code, key.Release); !reflect.DeepEqual(got, test.release) {
+			t.Errorf("keycode %d release: got %v, expected %v", test.code, got, test.release)
+		}
+	}
+}
+
+func TestDispatchCtrlSpace(t *testing.T) {
+	ctx := newTestContext(t, "us", "")
+	const (
+		keySpace = 65
+		// ctrlMask is the Control modifier mask.
+		ctrlMask = 1 << 2
+	)
+	ctx.UpdateMask(ctrlMask, 0, 0, 0, 0, 0)
+	got := ctx.DispatchKey(keySpace, key.Press)
+	exp := []event.Event{key.Event{Name: key.NameSpace, Sym: "space", ScanCode: keySpace - 8, Modifiers: key.ModCtrl}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("Ctrl+Space: got %v, expected %v", got, exp)
+	}
+}
+
+func TestDispatchScanCode(t *testing.T) {
+	ctx := newTestContext(t, "fr", "")
+	const (
+		// keyQ is the key labelled Q on US keyboards
+		// and A on French keyboards.
+		keyQ = 24
+		// evdevQ is the evdev code of keyQ.
+		evdevQ = 16
+	)
+	got := ctx.DispatchKey(keyQ, key.Press)
+	exp := []event.Event{key.Event{Name: "A", Sym: "a", ScanCode: evdevQ}, key.EditEvent{Text: "a"}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("AZERTY A: got %v, expected %v", got, exp)
+	}
+}
+
+func TestDispatchDeadKey(t *testing.T) {
+	// The apostrophe key of the international US layout
+	// is a dead acute accent.
+	ctx := newTestContext(t, "us", "intl")
+	const (
+		keyApostrophe = 48
+		keyE          = 26
+	)
+	if got := ctx.DispatchKey(keyApostrophe, key.Press); len(got) > 0 {
+		t.Errorf("dead key press: got %v, expected no events", got)
+	}
+	if got := ctx.DispatchKey(keyApostrophe, key.Release); len(got) > 0 {
+		t.Errorf("dead key release: got %v, expected no events", got)
+	}
+	got := ctx.DispatchKey(keyE, key.Press)
+	exp := []event.Event{key.Event{Name: "E", Sym: "e", ScanCode: keyE - 8}, key.EditEvent{Text: "é"}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("composed key: got %v, expected %v", got, exp)
+	}
+	// The compose state is reset after a composed character.
+	got = ctx.DispatchKey(keyE, key.Press)
+	exp = []event.Event{key.Event{Name: "E", Sym: "e", ScanCode: keyE - 8}, key.EditEvent{Text: "e"}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("second key: got %v, expected %v", got, exp)
+	}
+}
+
+func TestDispatchTextBufferGrowth(t *testing.T) {
+	ctx := newTestContext(t, "us", "intl")
+	const (
+		keyApostrophe = 48
+		keyE          = 26
+		key5          = 14
+		// level3Mask is the Mod5 mask of the AltGr key.
+		level3Mask = 1 << 7
+	)
+	// Start every lookup with a buffer too small for the
+	// result, forcing a retry with a larger buffer.
+	ctx.utf8Buf = make([]byte, 1)
+	ctx.DispatchKey(keyApostrophe, key.Press)
+	if got := editText(ctx.DispatchKey(keyE, key.Press)); got != "é" {
+		t.Errorf("composed key: got %q, expected %q", got, "é")
+	}
+	ctx.utf8Buf = make([]byte, 1)
+	ctx.UpdateMask(level3Mask, 0, 0, 0, 0, 0)
+	if got := editText(ctx.DispatchKey(key5, key.Press)); got != "€" {
+		t.Errorf("AltGr+5: got %q, expected %q", got, "€")
+	}
+	// The retries leave no state behind.
+	ctx.UpdateMask(0, 0, 0, 0, 0, 0)
+	if got := editText(ctx.DispatchKey(keyE, key.Press)); got != "e" {
+		t.Errorf("plain key: got %q, expected %q", got, "e")
+	}
+}
+
+// editText returns the text of the EditEvents among events.
+func editText(events []event.Event) string {
+	var text string
+	for _, e := range events {
+		if e, ok := e.(key.EditEvent); ok {
+			text += e.Text
+		}
+	}
+	return text
+}
+
+func TestDispatchKeySym(t *testing.T) {
+	ctx := newTestContext(t, "us", "")
+	const (
+		keyCapsLock = 66
+		keyMenu     = 135
+	)
+	// Keys without a name are reported by their keysym name.
+	got := ctx.DispatchKey(keyMenu, key.Press)
+	exp := []event.Event{key.Event{Sym: "Menu", ScanCode: keyMenu - 8}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("Menu: got %v, expected %v", got, exp)
+	}
+	// Lock keys are not.
+	if got := ctx.DispatchKey(keyCapsLock, key.Press); len(got) > 0 {
+		t.Errorf("Caps Lock: got %v, expected no events", got)
+	}
+}
+
+func TestDispatchModifierKeys(t *testing.T) {
+	ctx := newTestContext(t, "us", "")
+	tests := []struct {
+		code uint32
+		name string
+		sym  string
+		mod  key.Modifiers
+	}{
+		{50, key.NameShift, "Shift_L", key.ModShift},
+		{62, key.NameShift, "Shift_R", key.ModShift},
+		{37, key.NameCtrl, "Control_L", key.ModCtrl},
+		{105, key.NameCtrl, "Control_R", key.ModCtrl},
+		{64, key.NameAlt, "Alt_L", key.ModAlt},
+		{133, key.NameSuper, "Super_L", key.ModSuper},
+		{134, key.NameSuper, "Super_R", key.ModSuper},
+	}
+	for _, test := range tests {
+		got := ctx.DispatchKey(test.code, key.Press)
+		exp := []event.Event{key.Event{Name: test.name, Sym: test.sym, ScanCode: test.code - 8, Modifiers: test.mod}}
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("%s press: got %v, expected %v", test.sym, got, exp)
+		}
+		got = ctx.DispatchKey(test.code, key.Release)
+		exp = []event.Event{key.Event{Name: test.name, Sym: test.sym, ScanCode: test.code - 8, State: key.Release}}
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("%s release: got %v, expected %v", test.sym, got, exp)
+		}
+	}
+}
@@ -3,14 +3,20 @@
 package app
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"image"
+	"image/color"
+	"sync"
 	"time"
+	"unsafe"
 
 	"gioui.org/app/internal/input"
 	"gioui.org/app/internal/window"
 	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
 	"gioui.org/io/profile"
 	"gioui.org/io/system"
 	"gioui.org/op"
@@ -27,9 +33,8 @@ type Window struct {
 	driver window.Driver
 	loop   *renderLoop
 
-	// driverFuncs is a channel of functions to run when
-	// the Window has a valid driver.
-	driverFuncs chan func()
+	// driverWakeup signals new functions in driverFuncs.
+	driverWakeup chan struct{}
 
 	out         chan event.Event
 	in          chan event.Event
@@ -47,6 +52,31 @@ type Window struct {
 	queue Queue
 
 	callbacks callbacks
+
+	// mu protects the fields below.
+	mu sync.Mutex
+	// driverFuncs are the functions to run, in order, when
+	// the Window has a valid driver.
+	driverFuncs []func()
+	// destroyed is set when the window loop has exited.
+	destroyed bool
+	// maximized is the last known maximized state.
+	maximized bool
+	// focused is the last known keyboard focus state.
+	focused bool
+	// alwaysOnTop is the last known always on top state.
+	alwaysOnTop bool
+	// composited is the last known state of the compositing
+	// manager.
+	composited bool
+	// frameExtents is the last known size of the decorations.
+	frameExtents window.FrameExtentsEvent
+	// bounds is the last known window rectangle.
+	bounds image.Rectangle
+	// nativeDisplay and nativeWindow are the native handles
+	// of the driver, if it exposes them.
+	nativeDisplay unsafe.Pointer
+	nativeWindow  uintptr
 }
 
 type callbacks struct {
@@ -78,12 +108,17 @@ var ackEvent event.Event
 // NewWindow returns the window previously created by the
 // platform.
 //
-// BUG: Calling NewWindow more than once is not yet supported.
+// BUG: Calling NewWindow more than once is only supported on X11.
 func NewWindow(options ...Option) *Window {
 	opts := &window.Options{
-		Width:  unit.Dp(800),
-		Height: unit.Dp(600),
-		Title:  "Gio",
+		Width:     unit.Dp(800),
+		Height:    unit.Dp(600),
+		Title:     "Gio",
+		Resizable: true,
+		Decorated: true,
+		Focused:   true,
+		Opacity:   1,
+		Screen:    -1,
 	}
 
 	for _, o := range options {
@@ -91,15 +126,17 @@ func NewWindow(options ...Option) *Window {
 	}
 
 	w := &Window{
-		in:          make(chan event.Event),
-		out:         make(chan event.Event),
-		ack:         make(chan struct{}),
-		invalidates: make(chan struct{}, 1),
-		frames:      make(chan *op.Ops),
-		frameAck:    make(chan struct{}),
-		driverFuncs: make(chan func()),
+		in:           make(chan event.Event),
+		out:          make(chan event.Event),
+		ack:          make(chan struct{}),
+		invalidates:  make(chan struct{}, 1),
+		frames:       make(chan *op.Ops),
+		frameAck:     make(chan struct{}),
+		driverWakeup: make(chan struct{}, 1),
 	}
 	w.callbacks.w = w
+	w.maximized = opts.Maximized
+	w.alwaysOnTop = opts.AlwaysOnTop
 	go w.run(opts)
 	return w
 }
@@ -159,6 +196,513 @@ func (w *Window) Invalidate() {
 	}
 }
 
+// ScheduleWakeup requests a single FrameEvent at the time at, such as
+// for the end of an animation or the next tick of a clock. Unlike
+// animating until then, the window sleeps in the meantime. Multiple
+// scheduled wakeups collapse to the earliest.
+//
+// ScheduleWakeup is safe for concurrent use.
+func (w *Window) ScheduleWakeup(at time.Time) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.WakeupDriver); ok {
+			d.ScheduleWakeup(at)
+			return
+		}
+		w.setNextFrame(at)
+		w.updateAnimation()
+	})
+}
+
+// SetTitle updates the title of the window.
+func (w *Window) SetTitle(title string) {
+	w.driverDo(func() {
+		w.driver.SetTitle(title)
+	})
+}
+
+// SetSize requests a new size for the window. The size
+// change is reported by the following FrameEvent.
+//
+// BUG: SetSize is only supported on X11.
+func (w *Window) SetSize(width, height unit.Value) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.SizeDriver); ok {
+			d.SetSize(width, height)
+		}
+	})
+}
+
+// SetMinMaxSize updates the size constraints of the
+// window. Zero values are ignored.
+//
+// BUG: SetMinMaxSize is only supported on X11.
+func (w *Window) SetMinMaxSize(minWidth, minHeight, maxWidth, maxHeight unit.Value) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.SizeHintsDriver); ok {
+			d.SetMinMaxSize(minWidth, minHeight, maxWidth, maxHeight)
+		}
+	})
+}
+
+// SetPos moves the window to a position in pixels, relative to
+// the screen. The position is of the top left corner of the
+// window decorations, see FrameExtents. The window manager may
+// ignore the request.
+//
+// BUG: SetPos is only supported on X11.
+func (w *Window) SetPos(x, y int) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.PosDriver); ok {
+			d.SetPos(x, y)
+		}
+	})
+}
+
+// FrameExtents returns the widths in pixels of the decorations
+// the window manager draws around the window, such as the title
+// bar. The extents are zero until the window manager reports them,
+// typically after the window is first shown.
+//
+// BUG: FrameExtents is only supported on X11.
+func (w *Window) FrameExtents() (left, right, top, bottom int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e := w.frameExtents
+	return e.Left, e.Right, e.Top, e.Bottom
+}
+
+// Bounds returns the rectangle of the window in screen pixels,
+// including the decorations of the window manager. It is cheap
+// to call, because the rectangle is updated when the window
+// moves or resizes. Window managers place windows
+// asynchronously, so the bounds may briefly lag behind
+// requests such as SetPos.
+//
+// BUG: Bounds is only supported on X11.
+func (w *Window) Bounds() image.Rectangle {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.bounds
+}
+
+// NativeWindow returns the native handles of the window for use
+// with other platform libraries. On X11, display is the Xlib
+// Display pointer and window is the window XID. Both are zero
+// until the window is created.
+//
+// Xlib is not safe for concurrent use, and the window goroutine
+// uses the Display while it processes events. The handles must
+// only be used while handling an event received from Events,
+// before receiving the next one, and must not be used after
+// the DestroyEvent.
+//
+// BUG: NativeWindow is only supported on X11.
+func (w *Window) NativeWindow() (display unsafe.Pointer, window uintptr) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.nativeDisplay, w.nativeWindow
+}
+
+// SetPrimarySelection replaces the content of the X11 PRIMARY
+// selection, which other programs paste on middle clicks. Text
+// widgets typically set it to the selected text.
+//
+// BUG: SetPrimarySelection is only supported on X11.
+func (w *Window) SetPrimarySelection(s string) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.PrimarySelectionDriver); ok {
+			d.SetPrimarySelection(s)
+		}
+	})
+}
+
+// SetCursor sets the mouse cursor shown over the window.
+//
+// BUG: SetCursor is only supported on X11.
+func (w *Window) SetCursor(name pointer.CursorName) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.CursorDriver); ok {
+			d.SetCursor(name)
+		}
+	})
+}
+
+// SetFullscreen switches the window to or from fullscreen.
+//
+// BUG: SetFullscreen is only supported on X11.
+func (w *Window) SetFullscreen(fullscreen bool) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.FullscreenDriver); ok {
+			d.SetFullscreen(fullscreen)
+		}
+	})
+}
+
+// SetMaximized maximizes or restores the window.
+//
+// BUG: SetMaximized is only supported on X11.
+func (w *Window) SetMaximized(maximized bool) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.MaximizeDriver); ok {
+			d.SetMaximized(maximized)
+		}
+	})
+}
+
+// Maximized reports whether the window is maximized, for
+// example to restore the state in a later session. The
+// state is updated when the window manager applies it.
+func (w *Window) Maximized() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.maximized
+}
+
+// SetDecorated shows or hides the title bar and borders
+// drawn by the window manager. Windows without decorations
+// can be moved and resized with StartMove and StartResize.
+//
+// BUG: SetDecorated is only supported on X11.
+func (w *Window) SetDecorated(decorated bool) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.DecorationDriver); ok {
+			d.SetDecorated(decorated)
+		}
+	})
+}
+
+// StartMove lets the user move the window with the pointer. It
+// must be called while handling a pointer.Press, for example on a
+// custom title bar, because the window manager takes over the
+// pressed button. The move ends when the button is released.
+//
+// BUG: StartMove is only supported on X11.
+func (w *Window) StartMove() {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.MoveResizeDriver); ok {
+			d.Move()
+		}
+	})
+}
+
+// StartResize lets the user resize the window edge or corner with
+// the pointer. Like StartMove, it must be called while handling a
+// pointer.Press.
+//
+// BUG: StartResize is only supported on X11.
+func (w *Window) StartResize(edge pointer.Edge) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.MoveResizeDriver); ok {
+			d.Resize(edge)
+		}
+	})
+}
+
+// GrabPointer delivers all pointer events to the window, even
+// when the pointer is outside it, until ReleasePointer is
+// called or all pointer buttons are released. It is useful for
+// drags that start with a pointer.Press.
+//
+// BUG: GrabPointer is only supported on X11.
+func (w *Window) GrabPointer() {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.PointerGrabDriver); ok {
+			d.GrabPointer()
+		}
+	})
+}
+
+// ReleasePointer releases a grab from GrabPointer.
+func (w *Window) ReleasePointer() {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.PointerGrabDriver); ok {
+			d.ReleasePointer()
+		}
+	})
+}
+
+// GrabKeyboard delivers all key events to the window, for
+// example for a password prompt, until ReleaseKeyboard is
+// called. No other program receives key events during the
+// grab, including the window manager's shortcuts, so grabs
+// should be short and always released.
+//
+// BUG: GrabKeyboard is only supported on X11.
+func (w *Window) GrabKeyboard() {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.KeyboardGrabDriver); ok {
+			d.GrabKeyboard()
+		}
+	})
+}
+
+// ReleaseKeyboard releases a grab from GrabKeyboard.
+func (w *Window) ReleaseKeyboard() {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.KeyboardGrabDriver); ok {
+			d.ReleaseKeyboard()
+		}
+	})
+}
+
+// RegisterHotkey delivers a system.HotkeyEvent when the key
+// with the keysym name sym, such as "F12" or "XF86AudioPlay",
+// is pressed with the modifiers, even if another window has
+// keyboard focus. The key press is not delivered to the
+// focused window. Registration fails if another program
+// already uses the hotkey.
+//
+// Hotkeys apply to the whole desktop session; register
+// few of them and let the user choose them.
+//
+// BUG: RegisterHotkey is only supported on X11.
+func (w *Window) RegisterHotkey(sym string, mods key.Modifiers) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.HotkeyDriver); ok {
+			d.RegisterHotkey(sym, mods)
+		}
+	})
+}
+
+// UnregisterHotkey removes a hotkey added by RegisterHotkey.
+func (w *Window) UnregisterHotkey(sym string, mods key.Modifiers) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.HotkeyDriver); ok {
+			d.UnregisterHotkey(sym, mods)
+		}
+	})
+}
+
+// SetAlwaysOnTop keeps the window above other windows, or
+// restores its normal stacking.
+//
+// BUG: SetAlwaysOnTop is only supported on X11.
+func (w *Window) SetAlwaysOnTop(on bool) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.AlwaysOnTopDriver); ok {
+			d.SetAlwaysOnTop(on)
+		}
+	})
+}
+
+// SetType changes the role of the window. Some window managers
+// only apply the role of a window when it is shown. Unknown types
+// are treated as NormalWindow.
+//
+// BUG: SetType is only supported on X11.
+func (w *Window) SetType(t WindowType) {
+	name := t.x11Name()
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.TypeDriver); ok {
+			d.SetType(name)
+		}
+	})
+}
+
+// SetTransientFor marks the window as transient for the X11
+// window parent as described by the TransientFor option. A zero
+// parent makes the window a normal window again.
+//
+// BUG: SetTransientFor is only supported on X11.
+func (w *Window) SetTransientFor(parent uintptr) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.TransientDriver); ok {
+			d.SetTransientFor(parent)
+		}
+	})
+}
+
+// SetUrgent asks the desktop to draw the attention of the user to
+// the window, typically by flashing its taskbar entry. The urgency
+// is cleared when the window receives focus.
+//
+// BUG: SetUrgent is only supported on X11.
+func (w *Window) SetUrgent(urgent bool) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.UrgentDriver); ok {
+			d.SetUrgent(urgent)
+		}
+	})
+}
+
+// AlwaysOnTop reports whether the window is kept above other
+// windows. The state is updated when the window manager
+// applies it.
+func (w *Window) AlwaysOnTop() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.alwaysOnTop
+}
+
+// Composited reports whether a compositing manager is running, for
+// deciding whether to use translucency such as the Opacity option.
+// A system.CompositorEvent is sent when the state changes.
+//
+// BUG: Composited is only supported on X11.
+func (w *Window) Composited() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.composited
+}
+
+// Iconify minimizes the window. The window is in
+// system.StagePaused until it is restored.
+//
+// BUG: Iconify is only supported on X11.
+func (w *Window) Iconify() {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.IconifyDriver); ok {
+			d.Iconify()
+		}
+	})
+}
+
+// Focused reports whether the window has keyboard focus.
+func (w *Window) Focused() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.focused
+}
+
+// SetIcon sets the window icon. Supply more than one
+// image to provide the icon in several sizes.
+//
+// BUG: SetIcon is only supported on X11.
+func (w *Window) SetIcon(icon ...image.Image) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.IconDriver); ok {
+			d.SetIcon(icon)
+		}
+	})
+}
+
+// SetOpacity sets the opacity of the window, from 0 for a
+// transparent window to 1 for an opaque window. Values
+// outside that range are clamped. The opacity is applied
+// by the compositor, if any.
+//
+// BUG: SetOpacity is only supported on X11.
+func (w *Window) SetOpacity(opacity float32) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.OpacityDriver); ok {
+			d.SetOpacity(opacity)
+		}
+	})
+}
+
+// Close the window. The window's event loop exits after
+// a DestroyEvent.
+//
+// Close is typically called after cancelling a
+// system.CommandEvent of type system.CommandClose, to
+// close the window after asking for confirmation.
+//
+// BUG: Close is only supported on X11.
+func (w *Window) Close() {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.CloseDriver); ok {
+			d.Close()
+		}
+	})
+}
+
+// ReadClipboard requests the clipboard content. The content is
+// delivered as a system.ClipboardEvent. Reads fail with
+// context.DeadlineExceeded if the clipboard owner doesn't respond
+// within a few seconds.
+//
+// BUG: The clipboard is only supported on X11.
+func (w *Window) ReadClipboard() {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.ClipboardDriver); ok {
+			d.ReadClipboard()
+		}
+	})
+}
+
+// WriteClipboard writes a string to the clipboard. A
+// system.ClipboardLostEvent is sent when another program
+// replaces it.
+//
+// BUG: The clipboard is only supported on X11.
+func (w *Window) WriteClipboard(s string) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.ClipboardDriver); ok {
+			d.WriteClipboard(s)
+		}
+	})
+}
+
+// ReadClipboardMIME requests the clipboard content of a MIME type
+// such as "image/png" or "text/html". The content is delivered as
+// a system.ClipboardEvent, with an empty MIME field if the
+// clipboard has no content of the type.
+//
+// BUG: The clipboard is only supported on X11.
+func (w *Window) ReadClipboardMIME(mime string) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.MIMEClipboardDriver); ok {
+			d.ReadClipboardMIME(mime)
+		}
+	})
+}
+
+// ReadClipboardContext is like ReadClipboardMIME, except that the
+// read fails with the error of ctx if it is done before the content
+// arrives. The error is delivered in the Err field of a
+// system.ClipboardEvent.
+//
+// BUG: The clipboard is only supported on X11.
+func (w *Window) ReadClipboardContext(ctx context.Context, mime string) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.ContextClipboardDriver); ok {
+			d.ReadClipboardContext(ctx, mime)
+		}
+	})
+}
+
+// WriteClipboardMIME replaces the clipboard content with data of
+// a MIME type. The data must not be modified afterwards, and is
+// released after a system.ClipboardLostEvent.
+//
+// BUG: The clipboard is only supported on X11.
+func (w *Window) WriteClipboardMIME(mime string, data []byte) {
+	w.driverDo(func() {
+		if d, ok := w.driver.(window.MIMEClipboardDriver); ok {
+			d.WriteClipboardMIME(mime, data)
+		}
+	})
+}
+
+// driverDo calls f on the window goroutine once
+// a valid driver is available. Functions are called
+// in the order of the driverDo calls, and dropped when
+// the window is destroyed.
+func (w *Window) driverDo(f func()) {
+	w.mu.Lock()
+	if w.destroyed {
+		w.mu.Unlock()
+		return
+	}
+	w.driverFuncs = append(w.driverFuncs, f)
+	w.mu.Unlock()
+	select {
+	case w.driverWakeup <- struct{}{}:
+	default:
+	}
+}
+
+// runDriverFuncs calls the pending functions of driverDo.
+func (w *Window) runDriverFuncs() {
+	w.mu.Lock()
+	funcs := w.driverFuncs
+	w.driverFuncs = nil
+	w.mu.Unlock()
+	for _, f := range funcs {
+		f()
+	}
+}
+
 func (w *Window) updateAnimation() {
 	animate := false
 	if w.delayedDraw != nil {
@@ -225,14 +769,20 @@ func (w *Window) destroyGPU() {
 func (w *Window) run(opts *window.Options) {
 	defer close(w.in)
 	defer close(w.out)
+	defer func() {
+		w.mu.Lock()
+		w.destroyed = true
+		w.driverFuncs = nil
+		w.mu.Unlock()
+	}()
 	if err := window.NewWindow(&w.callbacks, opts); err != nil {
 		w.out <- system.DestroyEvent{Err: err}
 		return
 	}
 	for {
-		var driverFuncs chan func() = nil
+		var driverWakeup chan struct{}
 		if w.driver != nil {
-			driverFuncs = w.driverFuncs
+			driverWakeup = w.driverWakeup
 		}
 		var timer <-chan time.Time
 		if w.delayedDraw != nil {
@@ -243,10 +793,16 @@ func (w *Window) run(opts *window.Options) {
 			w.setNextFrame(time.Time{})
 			w.updateAnimation()
 		case <-w.invalidates:
+			// Drivers that draw on request don't need the
+			// window to animate for a single frame.
+			if d, ok := w.driver.(window.InvalidateDriver); ok && w.stage >= system.StageRunning {
+				d.Invalidate()
+				break
+			}
 			w.setNextFrame(time.Time{})
 			w.updateAnimation()
-		case f := <-driverFuncs:
-			f()
+		case <-driverWakeup:
+			w.runDriverFuncs()
 		case e := <-w.in:
 			switch e2 := e.(type) {
 			case system.StageEvent:
@@ -328,6 +884,48 @@ func (w *Window) run(opts *window.Options) {
 				w.waitAck()
 			case driverEvent:
 				w.driver = e2.driver
+				if d, ok := w.driver.(window.NativeDriver); ok {
+					disp, win := d.NativeWindow()
+					w.mu.Lock()
+					w.nativeDisplay, w.nativeWindow = disp, win
+					w.mu.Unlock()
+				}
+				if d, ok := w.driver.(window.CompositorDriver); ok {
+					composited := d.Composited()
+					w.mu.Lock()
+					w.composited = composited
+					w.mu.Unlock()
+				}
+			case key.FocusEvent:
+				w.mu.Lock()
+				w.focused = e2.Focus
+				w.mu.Unlock()
+				if w.queue.q.Add(e2) {
+					w.setNextFrame(time.Time{})
+					w.updateAnimation()
+				}
+				w.out <- e
+			case window.MaximizeEvent:
+				w.mu.Lock()
+				w.maximized = e2.Maximized
+				w.mu.Unlock()
+			case window.AlwaysOnTopEvent:
+				w.mu.Lock()
+				w.alwaysOnTop = e2.AlwaysOnTop
+				w.mu.Unlock()
+			case system.CompositorEvent:
+				w.mu.Lock()
+				w.composited = e2.Composited
+				w.mu.Unlock()
+				w.out <- e
+			case window.FrameExtentsEvent:
+				w.mu.Lock()
+				w.frameExtents = e2
+				w.mu.Unlock()
+			case window.BoundsEvent:
+				w.mu.Lock()
+				w.bounds = e2.Bounds
+				w.mu.Unlock()
 			case system.DestroyEvent:
 				w.destroyGPU()
 				w.out <- e2
@@ -370,4 +968,372 @@ func Size(w, h unit.Value) Option {
 	}
 }
 
+// Icon sets the window icon. Supply more than one
+// image to provide the icon in several sizes.
+//
+// BUG: Icon is only supported on X11.
+func Icon(icon ...image.Image) Option {
+	return func(opts *window.Options) {
+		opts.Icon = icon
+	}
+}
+
+// MinSize sets the minimum size of the window.
+//
+// BUG: MinSize is only supported on X11.
+func MinSize(w, h unit.Value) Option {
+	return func(opts *window.Options) {
+		opts.MinWidth = w
+		opts.MinHeight = h
+	}
+}
+
+// MaxSize sets the maximum size of the window.
+//
+// BUG: MaxSize is only supported on X11.
+func MaxSize(w, h unit.Value) Option {
+	return func(opts *window.Options) {
+		opts.MaxWidth = w
+		opts.MaxHeight = h
+	}
+}
+
+// Class sets the window class, used by X11 window managers
+// to identify the application in window rules. The default
+// class is the program name.
+func Class(class string) Option {
+	return func(opts *window.Options) {
+		opts.Class = class
+	}
+}
+
+// Role sets the window role, used by X11 session managers to
+// tell the windows of a program apart, such as "main" or
+// "preferences", and restore their geometry.
+func Role(role string) Option {
+	return func(opts *window.Options) {
+		opts.Role = role
+	}
+}
+
+// Pos sets the initial position of the window in pixels,
+// relative to the screen. Window managers may ignore the
+// position.
+//
+// BUG: Pos is only supported on X11.
+func Pos(x, y int) Option {
+	return func(opts *window.Options) {
+		opts.Pos = image.Pt(x, y)
+	}
+}
+
+// ScrollScale sets the scroll distance in pixels of a mouse
+// wheel step.
+//
+// BUG: ScrollScale is only supported on X11.
+func ScrollScale(scale float32) Option {
+	return func(opts *window.Options) {
+		opts.ScrollScale = scale
+	}
+}
+
+// Display sets the name of the X11 display to open the window
+// on, such as ":1". The default is the DISPLAY environment
+// variable.
+func Display(name string) Option {
+	return func(opts *window.Options) {
+		opts.Display = name
+	}
+}
+
+// Screen sets the X11 screen to open the window on, for
+// displays with several screens such as ":0.0" and ":0.1".
+// The default is the screen of the display name.
+func Screen(n int) Option {
+	return func(opts *window.Options) {
+		opts.Screen = n
+	}
+}
+
+// TransientFor marks the window as a dialog or tool window of
+// the X11 window parent, such as the window returned by
+// NativeWindow of another Window. Window managers keep transient
+// windows above and centered on their parent.
+func TransientFor(parent uintptr) Option {
+	return func(opts *window.Options) {
+		opts.TransientFor = parent
+	}
+}
+
+// CoalesceEdits opts the window to merge the text typed before a
+// frame into a single key.EditEvent, for text widgets that are
+// expensive to update. Text is not merged across other events,
+// except the key.Events of character keys, which are delivered
+// before the merged text. By default, every key press delivers
+// its own key.EditEvent.
+//
+// BUG: CoalesceEdits is only supported on X11.
+func CoalesceEdits() Option {
+	return func(opts *window.Options) {
+		opts.CoalesceEdits = true
+	}
+}
+
+// Wakeup requests a frame whenever a value is received from ch, for
+// programs that redraw in response to their own event sources.
+// Wakeups that arrive before a frame result in a single FrameEvent.
+//
+// BUG: Wakeup is only supported on X11.
+func Wakeup(ch <-chan struct{}) Option {
+	return func(opts *window.Options) {
+		opts.Wakeup = ch
+	}
+}
+
+// MaxFPS limits the rate of frames caused by animation and
+// invalidation to fps frames per second, for slow renderers.
+// Frames the system requires, such as after a resize, are not
+// limited, and input events are delivered as they arrive.
+//
+// BUG: MaxFPS is only supported on X11.
+func MaxFPS(fps int) Option {
+	return func(opts *window.Options) {
+		opts.MaxFPS = fps
+	}
+}
+
+// FontScale scales text, measured in sp, relative to the rest of
+// the user interface, measured in dp. On X11 it overrides the
+// Gio.fontScale resource. The default is 1.
+func FontScale(scale float32) Option {
+	return func(opts *window.Options) {
+		opts.FontScale = scale
+	}
+}
+
+// ClientMessage is an X11 client message, as received by the
+// handler of the ClientMessages option.
+type ClientMessage = window.ClientMessage
+
+// ClientMessages installs a handler for the X11 client messages
+// sent to the window that Gio doesn't handle itself, such as
+// messages of custom atoms used for inter-client communication.
+//
+// The handler is called on the event loop goroutine of the window,
+// concurrently with the goroutine receiving events from Events, and
+// the window doesn't process other events until it returns. It must
+// synchronize its access to state shared with other goroutines, and
+// it must not block.
+func ClientMessages(handler func(msg ClientMessage)) Option {
+	return func(opts *window.Options) {
+		opts.ClientMessage = handler
+	}
+}
+
+// Embed opts the window to be embedded in the X11 window
+// with the id parent through the XEmbed protocol, for
+// example in a panel.
+func Embed(parent uintptr) Option {
+	return func(opts *window.Options) {
+		opts.Embed = parent
+	}
+}
+
+// Centered opts the window to be centered on the screen.
+// It overrides Pos.
+//
+// BUG: Centered is only supported on X11.
+func Centered() Option {
+	return func(opts *window.Options) {
+		opts.Centered = true
+	}
+}
+
+// InputMask is a set of input categories, for the Input option.
+type InputMask = window.InputMask
+
+const (
+	// KeyboardInput is key presses and releases.
+	KeyboardInput = window.KeyboardInput
+	// ButtonInput is pointer button presses and releases,
+	// including scrolling and touches.
+	ButtonInput = window.ButtonInput
+	// MotionInput is pointer motion and crossing.
+	MotionInput = window.MotionInput
+	// FocusInput is changes of the keyboard focus.
+	FocusInput = window.FocusInput
+	// AllInput is every input category, the default.
+	AllInput = window.AllInput
+)
+
+// Input limits the input the window receives to the categories in
+// mask. Windows that don't need pointer motion, such as static
+// dashboards, avoid the cost of its events. Without MotionInput,
+// scrolling happens in whole wheel steps.
+//
+// BUG: Input is only supported on X11.
+func Input(mask InputMask) Option {
+	return func(opts *window.Options) {
+		opts.DisabledInput = AllInput &^ mask
+	}
+}
+
+// ClickInterval sets the maximum time between the button presses
+// of a double click.
+//
+// BUG: ClickInterval is only supported on X11.
+func ClickInterval(d time.Duration) Option {
+	return func(opts *window.Options) {
+		opts.ClickInterval = d
+	}
+}
+
+// Unfocused opts the window to not take keyboard focus
+// when it is shown.
+//
+// BUG: Unfocused is only supported on X11.
+func Unfocused() Option {
+	return func(opts *window.Options) {
+		opts.Focused = false
+	}
+}
+
+// Resizable sets whether the user can resize the window.
+// Windows are resizable by default.
+//
+// BUG: Resizable is only supported on X11.
+func Resizable(resizable bool) Option {
+	return func(opts *window.Options) {
+		opts.Resizable = resizable
+	}
+}
+
+// Maximized opts the window to start maximized.
+//
+// BUG: Maximized is only supported on X11.
+func Maximized() Option {
+	return func(opts *window.Options) {
+		opts.Maximized = true
+	}
+}
+
+// Decorated controls whether the window manager draws the
+// title bar and borders of the window. The default is true.
+func Decorated(decorated bool) Option {
+	return func(opts *window.Options) {
+		opts.Decorated = decorated
+	}
+}
+
+// AlwaysOnTop opts the window to start above other windows.
+func AlwaysOnTop() Option {
+	return func(opts *window.Options) {
+		opts.AlwaysOnTop = true
+	}
+}
+
+// Fullscreen opts the window to start in fullscreen.
+func Fullscreen() Option {
+	return func(opts *window.Options) {
+		opts.Fullscreen = true
+	}
+}
+
+// WindowType is the role of a window, which window managers
+// use to choose its decorations, stacking and taskbar entry.
+type WindowType uint8
+
+const (
+	// NormalWindow is a top-level application window.
+	NormalWindow WindowType = iota
+	// DialogWindow is a dialog of an application window.
+	DialogWindow
+	// UtilityWindow is a persistent tool window, such as
+	// a palette.
+	UtilityWindow
+	// DockWindow is a panel or status bar, typically kept
+	// above other windows on all desktops.
+	DockWindow
+	// SplashWindow is a splash screen shown while an
+	// application starts.
+	SplashWindow
+	// ToolbarWindow is a torn off toolbar.
+	ToolbarWindow
+	// MenuWindow is a torn off menu.
+	MenuWindow
+)
+
+// Type sets the role of the window. The default is
+// NormalWindow, which is also used for unknown types.
+func Type(t WindowType) Option {
+	return func(opts *window.Options) {
+		opts.Type = t.x11Name()
+	}
+}
+
+// Opacity sets the initial opacity of the window. See
+// Window.SetOpacity.
+func Opacity(opacity float32) Option {
+	return func(opts *window.Options) {
+		opts.Opacity = opacity
+	}
+}
+
+// BackgroundColor sets the color shown in the window until the
+// first frame is drawn, to avoid a flash of undefined content.
+// The alpha of the color is ignored.
+//
+// BUG: BackgroundColor is only supported on X11.
+func BackgroundColor(c color.NRGBA) Option {
+	return func(opts *window.Options) {
+		c.A = 0xff
+		opts.BackgroundColor = c
+	}
+}
+
 func (driverEvent) ImplementsEvent() {}
+
+// x11Name returns the suffix of the _NET_WM_WINDOW_TYPE atom
+// of the type.
+func (t WindowType) x11Name() string {
+	switch t {
+	case NormalWindow:
+		return "NORMAL"
+	case DialogWindow:
+		return "DIALOG"
+	case UtilityWindow:
+		return "UTILITY"
+	case DockWindow:
+		return "DOCK"
+	case SplashWindow:
+		return "SPLASH"
+	case ToolbarWindow:
+		return "TOOLBAR"
+	case MenuWindow:
+		return "MENU"
+	default:
+		// Unknown types fall back to normal windows.
+		return "NORMAL"
+	}
+}
+
+func (t WindowType) String() string {
+	switch t {
+	case NormalWindow:
+		return "NormalWindow"
+	case DialogWindow:
+		return "DialogWindow"
+	case UtilityWindow:
+		return "UtilityWindow"
+	case DockWindow:
+		return "DockWindow"
+	case SplashWindow:
+		return "SplashWindow"
+	case ToolbarWindow:
+		return "ToolbarWindow"
+	case MenuWindow:
+		return "MenuWindow"
+	default:
+		return fmt.Sprintf("WindowType(%d)", t)
+	}
+}
@@ -90,6 +90,9 @@ func (a *App) run() error {
 		case e := <-a.w.Events():
 			switch e := e.(type) {
 			case key.Event:
+				if e.State != key.Press {
+					break
+				}
 				switch e.Name {
 				case key.NameEscape:
 					os.Exit(0)
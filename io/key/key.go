@@ -44,8 +44,29 @@ type Event struct {
 	// modifiers are ignored. For example, the "shift-1" and "ctrl-shift-1"
 	// combinations both give the Name "!" with the US keyboard layout.
 	Name string
+	// Sym is the platform specific name of the key, for binding
+	// keys that have no Name such as media keys. Events for
+	// keys without a Name have an empty Name and a non-empty
+	// Sym.
+	//
+	// Note: Sym is only implemented on the following platforms:
+	// X11, Wayland, where it is the keysym name.
+	Sym string
+	// ScanCode identifies the physical key independent of the
+	// keyboard layout, for binding keys by their position such
+	// as the WASD keys of games.
+	//
+	// Note: ScanCode is only implemented on the following platforms:
+	// X11, Wayland, where it is the Linux evdev key code, such as
+	// 17 for the key labelled W on a US keyboard.
+	ScanCode uint32
 	// Modifiers is the set of active modifiers when the key was pressed.
 	Modifiers Modifiers
+	// Repeat is set for the presses generated by holding
+	// down a key.
+	Repeat bool
+	// State is the state of the key when the event was fired.
+	State State
 }
 
 // An EditEvent is generated when text is input.
@@ -53,6 +74,19 @@ type EditEvent struct {
 	Text string
 }
 
+// State is the state of a key during an event.
+type State uint8
+
+const (
+	// Press is the state of a pressed key.
+	Press State = iota
+	// Release is the state of a key that has been released.
+	//
+	// Note: release events are only implemented on the following platforms:
+	// X11, Wayland.
+	Release
+)
+
 // Modifiers
 type Modifiers uint32
 
@@ -88,6 +122,43 @@ const (
 	NamePageUp         = "⇞"
 	NamePageDown       = "⇟"
 	NameTab            = "⇥"
+	NameInsert         = "⎀"
+	NameSpace          = "Space"
+	NameF1             = "F1"
+	NameF2             = "F2"
+	NameF3             = "F3"
+	NameF4             = "F4"
+	NameF5             = "F5"
+	NameF6             = "F6"
+	NameF7             = "F7"
+	NameF8             = "F8"
+	NameF9             = "F9"
+	NameF10            = "F10"
+	NameF11            = "F11"
+	NameF12            = "F12"
+
+	// Names for modifier keys. The left and right keys
+	// have the same name.
+	NameShift = "Shift"
+	NameCtrl  = "Ctrl"
+	NameAlt   = "Alt"
+	NameSuper = "Super"
+
+	// Names for media and browser keys.
+	NameMediaPlayPause = "MediaPlayPause"
+	NameMediaStop      = "MediaStop"
+	NameMediaNext      = "MediaNext"
+	NameMediaPrevious  = "MediaPrevious"
+	NameVolumeUp       = "VolumeUp"
+	NameVolumeDown     = "VolumeDown"
+	NameVolumeMute     = "VolumeMute"
+	NameBrightnessUp   = "BrightnessUp"
+	NameBrightnessDown = "BrightnessDown"
+	NameBrowserBack    = "BrowserBack"
+	NameBrowserForward = "BrowserForward"
+	NameBrowserRefresh = "BrowserRefresh"
+	NameBrowserHome    = "BrowserHome"
+	NameBrowserSearch  = "BrowserSearch"
 )
 
 // Contain reports whether m contains all modifiers
@@ -117,6 +188,17 @@ func (e Event) String() string {
 	return "{" + string(e.Name) + " " + e.Modifiers.String() + "}"
 }
 
+func (s State) String() string {
+	switch s {
+	case Press:
+		return "Press"
+	case Release:
+		return "Release"
+	default:
+		panic("invalid State")
+	}
+}
+
 func (m Modifiers) String() string {
 	var strs []string
 	if m.Contain(ModCtrl) {
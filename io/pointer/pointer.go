@@ -29,6 +29,10 @@ type Event struct {
 	// Time is when the event was received. The
 	// timestamp is relative to an undefined base.
 	Time time.Duration
+	// Timestamp is Time converted to the clock of the
+	// program, for comparison with time.Now. It is zero
+	// if the platform doesn't support the conversion.
+	Timestamp time.Time
 	// Buttons are the set of pressed mouse buttons for this event.
 	Buttons Buttons
 	// Hit is set when the event was within the registered
@@ -44,6 +48,11 @@ type Event struct {
 	// Modifiers is the set of active modifiers when
 	// the mouse button was pressed.
 	Modifiers key.Modifiers
+	// Clicks is the number of successive presses of the
+	// button, including this one, for Press and Release
+	// events. A double click has Clicks set to 2. Clicks
+	// is zero if the platform doesn't count clicks.
+	Clicks int
 }
 
 // AreaOp updates the hit area to the intersection of the current
@@ -82,6 +91,12 @@ type Source uint8
 // Buttons is a set of mouse buttons
 type Buttons uint8
 
+// CursorName is the name of a cursor.
+type CursorName string
+
+// Edge is an edge or corner of a window.
+type Edge uint8
+
 // Must match app/internal/input.areaKind
 type areaKind uint8
 
@@ -95,6 +110,10 @@ const (
 	Release
 	// Move of a pointer.
 	Move
+	// Enter is generated when a pointer enters the window.
+	Enter
+	// Leave is generated when a pointer leaves the window.
+	Leave
 )
 
 const (
@@ -118,6 +137,32 @@ const (
 	ButtonMiddle
 )
 
+const (
+	// CursorDefault is the default cursor.
+	CursorDefault CursorName = ""
+	// CursorText is for selecting and inserting text.
+	CursorText CursorName = "text"
+	// CursorPointer is for a link or clickable element.
+	CursorPointer CursorName = "pointer"
+	// CursorCrossHair is for a precise location.
+	CursorCrossHair CursorName = "crosshair"
+	// CursorColResize is for resizing horizontally.
+	CursorColResize CursorName = "col-resize"
+	// CursorRowResize is for resizing vertically.
+	CursorRowResize CursorName = "row-resize"
+)
+
+const (
+	EdgeTop Edge = iota
+	EdgeBottom
+	EdgeLeft
+	EdgeRight
+	EdgeTopLeft
+	EdgeTopRight
+	EdgeBottomLeft
+	EdgeBottomRight
+)
+
 const (
 	areaRect areaKind = iota
 	areaEllipse
@@ -176,6 +221,10 @@ func (t Type) String() string {
 		return "Cancel"
 	case Move:
 		return "Move"
+	case Enter:
+		return "Enter"
+	case Leave:
+		return "Leave"
 	default:
 		panic("unknown Type")
 	}
@@ -203,6 +252,29 @@ func (s Source) String() string {
 	}
 }
 
+func (e Edge) String() string {
+	switch e {
+	case EdgeTop:
+		return "EdgeTop"
+	case EdgeBottom:
+		return "EdgeBottom"
+	case EdgeLeft:
+		return "EdgeLeft"
+	case EdgeRight:
+		return "EdgeRight"
+	case EdgeTopLeft:
+		return "EdgeTopLeft"
+	case EdgeTopRight:
+		return "EdgeTopRight"
+	case EdgeBottomLeft:
+		return "EdgeBottomLeft"
+	case EdgeBottomRight:
+		return "EdgeBottomRight"
+	default:
+		panic("unknown edge")
+	}
+}
+
 // Contain reports whether the set b contains
 // all of the buttons.
 func (b Buttons) Contain(buttons Buttons) bool {
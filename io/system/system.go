@@ -8,6 +8,7 @@ import (
 	"image"
 	"time"
 
+	"gioui.org/io/key"
 	"gioui.org/op"
 	"gioui.org/unit"
 )
@@ -20,6 +21,11 @@ type FrameEvent struct {
 	Size image.Point
 	// Insets is the insets to apply.
 	Insets Insets
+	// Damage is the union of the regions of the window
+	// exposed by the system since the last frame, for
+	// renderers that redraw only what has changed. It is
+	// empty if no region was exposed.
+	Damage image.Rectangle
 	// Frame replaces the window's frame with the new
 	// frame.
 	Frame func(frame *op.Ops)
@@ -37,6 +43,15 @@ type Config interface {
 	unit.Converter
 }
 
+// RefreshRateConfig is implemented by the Config of
+// platforms that report the display refresh rate.
+type RefreshRateConfig interface {
+	Config
+	// RefreshRate returns the refresh rate of the display
+	// in Hz, or 0 if unknown.
+	RefreshRate() float32
+}
+
 // DestroyEvent is the last event sent through
 // a window event channel.
 type DestroyEvent struct {
@@ -45,6 +60,59 @@ type DestroyEvent struct {
 	Err error
 }
 
+// A ClipboardEvent is generated when the content of the
+// clipboard is received after a read request.
+type ClipboardEvent struct {
+	// Text is the content of a text read.
+	Text string
+	// MIME is the type of Data. It is empty if the clipboard
+	// has no content of the requested type.
+	MIME string
+	// Data is the raw content of the clipboard. Text reads
+	// set it to the UTF-8 encoding of Text.
+	Data []byte
+	// Err is non-nil if the read failed, such as when the
+	// clipboard owner didn't respond in time.
+	Err error
+}
+
+// A ClipboardLostEvent is generated when another program
+// takes over the clipboard content written by the window.
+// Programs may release the data they wrote.
+type ClipboardLostEvent struct{}
+
+// A CompositorEvent is generated on X11 when a compositing
+// manager starts or stops. Translucent windows and some window
+// effects are only shown with a compositing manager.
+type CompositorEvent struct {
+	Composited bool
+}
+
+// A PrimarySelectionEvent is generated on X11 when the
+// content of the PRIMARY selection is received, after
+// a middle click in the window. It is typically pasted
+// at the pointer position.
+type PrimarySelectionEvent struct {
+	Text string
+}
+
+// A DropEvent is generated when files are dropped
+// onto the window.
+type DropEvent struct {
+	// Files are the paths of the dropped files.
+	Files []string
+}
+
+// A HotkeyEvent is generated when a hotkey registered with
+// the window is pressed, even if the window doesn't have
+// keyboard focus.
+type HotkeyEvent struct {
+	// Sym is the keysym name of the key.
+	Sym string
+	// Modifiers are the modifiers of the hotkey.
+	Modifiers key.Modifiers
+}
+
 // Insets is the space taken up by
 // system decoration such as translucent
 // system bars and software keyboards.
@@ -58,6 +126,19 @@ type StageEvent struct {
 	Stage Stage
 }
 
+// A VisibilityEvent is generated when the window is shown,
+// hidden or covered by other windows. Unlike StageEvent, it
+// is for programs that adapt their work to what is visible,
+// such as by pausing video decoding.
+type VisibilityEvent struct {
+	// Visible reports whether the window is shown on
+	// the screen.
+	Visible bool
+	// Obscured reports whether a visible window is fully
+	// covered by other windows.
+	Obscured bool
+}
+
 // CommandEvent is a system event.
 type CommandEvent struct {
 	Type CommandType
@@ -83,6 +164,11 @@ const (
 	// CommandBack is the command for a back action
 	// such as the Android back button.
 	CommandBack CommandType = iota
+	// CommandClose is the command for a request to close
+	// the window, such as the close button of the window
+	// manager. Cancel the command to keep the window open
+	// and use Window.Close to close it later.
+	CommandClose
 )
 
 func (l Stage) String() string {
@@ -96,7 +182,14 @@ func (l Stage) String() string {
 	}
 }
 
-func (_ FrameEvent) ImplementsEvent()    {}
-func (_ StageEvent) ImplementsEvent()    {}
-func (_ *CommandEvent) ImplementsEvent() {}
-func (_ DestroyEvent) ImplementsEvent()  {}
+func (_ FrameEvent) ImplementsEvent()            {}
+func (_ StageEvent) ImplementsEvent()            {}
+func (_ VisibilityEvent) ImplementsEvent()       {}
+func (_ *CommandEvent) ImplementsEvent()         {}
+func (_ DestroyEvent) ImplementsEvent()          {}
+func (_ ClipboardEvent) ImplementsEvent()        {}
+func (_ ClipboardLostEvent) ImplementsEvent()    {}
+func (_ CompositorEvent) ImplementsEvent()       {}
+func (_ PrimarySelectionEvent) ImplementsEvent() {}
+func (_ DropEvent) ImplementsEvent()             {}
+func (_ HotkeyEvent) ImplementsEvent()           {}